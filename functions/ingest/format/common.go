@@ -6,6 +6,7 @@ import (
 	"github.com/v3io/v3io-tsdb/pkg/utils"
 	"sort"
 	"strings"
+	"time"
 )
 
 const tcollector string = "tcollector"
@@ -14,14 +15,102 @@ type Ingester interface {
 	Ingest(tsdbAppender tsdb.Appender, event nuclio.Event) interface{}
 }
 
-func IngesterForName(formatName string) Ingester {
+// Options holds the optional ingestion behaviors, shared by all formats
+type Options struct {
+
+	// used to report where samples were stored, in verbose mode
+	PartitionLocator *PartitionLocator
+
+	// if set, rejects samples that decrease the value of counters
+	MonotonicityValidator *MonotonicityValidator
+
+	// if set, converts sample values to the canonical unit of their metric
+	ValueScaler *ValueScaler
+
+	// the upper bounds of the histogram buckets of each histogram metric
+	HistogramBuckets map[string][]float64
+
+	// if set, samples without a time are assigned the server time
+	AssignTimestamps bool
+
+	// if set, samples that were already ingested are skipped
+	Deduplicator *Deduplicator
+
+	// the clock against which samples without a time are assigned one and relative sample times (e.g.
+	// "now-1m") are resolved. time.Now if nil
+	Now func() time.Time
+}
+
+func (o *Options) now() time.Time {
+	if o.Now == nil {
+		return time.Now()
+	}
+
+	return o.Now()
+}
+
+func IngesterForName(formatName string, options *Options) Ingester {
 	if strings.ToLower(formatName) == tcollector {
-		return tcollectorFormat{}
+		return tcollectorFormat{options: options}
 	} else {
-		return defaultTsdb{}
+		return defaultTsdb{options: options}
 	}
 }
 
+// scaleSample converts a sample value to its canonical unit, if configured in the options. samples are
+// scaled before being validated
+func scaleSample(options *Options, metricName string, sampleValue float64) float64 {
+	if options.ValueScaler != nil {
+		return options.ValueScaler.Scale(metricName, sampleValue)
+	}
+
+	return sampleValue
+}
+
+// timestampAssigner assigns the server time to the samples of a batch that have no time. times are
+// assigned in increasing order within a batch (samples assigned in the same millisecond are a millisecond
+// apart), so that they keep their order and don't overwrite each other. the order is only kept within a
+// batch - each replica assigns times by its own clock, so a series whose samples are ingested by several
+// replicas is skewed by the difference between their clocks, and its samples may be stored out of the order
+// in which they were ingested
+type timestampAssigner struct {
+	now      func() time.Time
+	lastTime int64
+}
+
+func (ta *timestampAssigner) assign() int64 {
+	sampleTime := ta.now().UnixNano() / int64(time.Millisecond)
+	if sampleTime <= ta.lastTime {
+		sampleTime = ta.lastTime + 1
+	}
+
+	ta.lastTime = sampleTime
+
+	return sampleTime
+}
+
+// recordSample records a sample that's about to be ingested, returning false if it was already ingested
+// (if configured in the options)
+func recordSample(options *Options, labels utils.Labels, sampleTime int64, sampleValue float64) bool {
+	return options.Deduplicator == nil || options.Deduplicator.Record(labels, sampleTime, sampleValue)
+}
+
+// forgetSample forgets a recorded sample that failed to be ingested, so that ingesting it again is retried
+func forgetSample(options *Options, labels utils.Labels, sampleTime int64, sampleValue float64) {
+	if options.Deduplicator != nil {
+		options.Deduplicator.Forget(labels, sampleTime, sampleValue)
+	}
+}
+
+// validateSample applies the validations configured in the options to a sample
+func validateSample(options *Options, metricName string, labels utils.Labels, sampleTime int64, sampleValue float64) error {
+	if options.MonotonicityValidator != nil {
+		return options.MonotonicityValidator.Validate(metricName, labels, sampleTime, sampleValue)
+	}
+
+	return nil
+}
+
 // convert map[string]string -> utils.Labels
 func getLabelsFromRequest(metricName string, labelsFromRequest map[string]string) utils.Labels {
 
@@ -61,3 +150,11 @@ func InternalError(msg string) nuclio.Response {
 		Body:        []byte(msg),
 	}
 }
+
+func JSONResponse(body []byte) nuclio.Response {
+	return nuclio.Response{
+		StatusCode:  200,
+		ContentType: "application/json",
+		Body:        body,
+	}
+}
@@ -0,0 +1,104 @@
+package format
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type sampleKey struct {
+	seriesHash uint64
+	time       int64
+	value      uint64
+}
+
+type seenSample struct {
+	key    sampleKey
+	seenAt time.Time
+}
+
+// Deduplicator detects samples that were already ingested (same series, time and value), so that
+// re-ingesting them (e.g. when a backfill reruns) doesn't count them twice. A sample is remembered for
+// the window since it was ingested, and at most maxSamples samples are remembered (the oldest are
+// forgotten first), which bounds the memory used to about 150 bytes per sample. The samples are kept
+// in memory, so each function replica only detects the samples it ingested (its workers should share one
+// Deduplicator, for a sample ingested by one to be detected by the others). the window is measured by the
+// given clock
+type Deduplicator struct {
+	window      time.Duration
+	maxSamples  int
+	now         func() time.Time
+	seenSamples map[sampleKey]*list.Element
+	order       *list.List
+	lock        sync.Mutex
+}
+
+func NewDeduplicator(window time.Duration, maxSamples int, now func() time.Time) *Deduplicator {
+	return &Deduplicator{
+		window:      window,
+		maxSamples:  maxSamples,
+		now:         now,
+		seenSamples: map[sampleKey]*list.Element{},
+		order:       list.New(),
+	}
+}
+
+// Record checks whether the sample was ingested within the window and, if it wasn't, remembers it as
+// ingested, returning false if the sample is a duplicate. The check and the record are done under the same
+// lock, so that of concurrent requests ingesting the same sample only one ingests it. A sample that fails
+// to be ingested should then be forgotten, so that it can be retried
+func (d *Deduplicator) Record(labels utils.Labels, sampleTime int64, sampleValue float64) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.expire()
+
+	key := getSampleKey(labels, sampleTime, sampleValue)
+	if _, found := d.seenSamples[key]; found {
+		return false
+	}
+
+	d.seenSamples[key] = d.order.PushBack(&seenSample{key: key, seenAt: d.now()})
+
+	for d.order.Len() > d.maxSamples {
+		d.remove(d.order.Front())
+	}
+
+	return true
+}
+
+// Forget forgets a recorded sample that failed to be ingested
+func (d *Deduplicator) Forget(labels utils.Labels, sampleTime int64, sampleValue float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if element, found := d.seenSamples[getSampleKey(labels, sampleTime, sampleValue)]; found {
+		d.remove(element)
+	}
+}
+
+// expire forgets the samples that were ingested before the window. samples are recorded in the order
+// in which they're ingested, so the oldest are first
+func (d *Deduplicator) expire() {
+	windowStart := d.now().Add(-d.window)
+
+	for d.order.Len() != 0 && d.order.Front().Value.(*seenSample).seenAt.Before(windowStart) {
+		d.remove(d.order.Front())
+	}
+}
+
+func (d *Deduplicator) remove(element *list.Element) {
+	d.order.Remove(element)
+	delete(d.seenSamples, element.Value.(*seenSample).key)
+}
+
+func getSampleKey(labels utils.Labels, sampleTime int64, sampleValue float64) sampleKey {
+	return sampleKey{
+		seriesHash: labels.Hash(),
+		time:       sampleTime,
+		value:      math.Float64bits(sampleValue),
+	}
+}
@@ -0,0 +1,141 @@
+// +build unit
+
+package format
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type dedupSuite struct {
+	suite.Suite
+	now    time.Time
+	labels utils.Labels
+}
+
+func (suite *dedupSuite) SetupTest() {
+	suite.now = time.Unix(1000, 0)
+	suite.labels = utils.LabelsFromStringList("__name__", "cpu", "host", "a")
+}
+
+func (suite *dedupSuite) TestWindowExpires() {
+	deduplicator := suite.newDeduplicator(time.Minute, 10)
+
+	suite.Require().True(deduplicator.Record(suite.labels, 1000, 1))
+	suite.Require().False(deduplicator.Record(suite.labels, 1000, 1))
+	suite.Require().True(deduplicator.Record(suite.labels, 1000, 2))
+
+	// still within the window
+	suite.now = suite.now.Add(time.Minute)
+	suite.Require().False(deduplicator.Record(suite.labels, 1000, 1))
+
+	// past the window, the sample is forgotten
+	suite.now = suite.now.Add(time.Second)
+	suite.Require().True(deduplicator.Record(suite.labels, 1000, 1))
+}
+
+func (suite *dedupSuite) TestMaxSamples() {
+	deduplicator := suite.newDeduplicator(time.Minute, 2)
+
+	for sampleTime := int64(1); sampleTime <= 3; sampleTime++ {
+		suite.Require().True(deduplicator.Record(suite.labels, sampleTime, 1))
+	}
+
+	// the oldest sample is forgotten first
+	suite.Require().False(deduplicator.Record(suite.labels, 3, 1))
+	suite.Require().False(deduplicator.Record(suite.labels, 2, 1))
+	suite.Require().True(deduplicator.Record(suite.labels, 1, 1))
+}
+
+func (suite *dedupSuite) TestForget() {
+	deduplicator := suite.newDeduplicator(time.Minute, 10)
+
+	// a sample that failed to be ingested can be retried
+	suite.Require().True(deduplicator.Record(suite.labels, 1000, 1))
+	deduplicator.Forget(suite.labels, 1000, 1)
+	suite.Require().True(deduplicator.Record(suite.labels, 1000, 1))
+}
+
+func (suite *dedupSuite) TestConcurrentRecord() {
+	deduplicator := suite.newDeduplicator(time.Minute, 10)
+
+	var recorded int32
+	var waitGroup sync.WaitGroup
+
+	for requestIdx := 0; requestIdx < 100; requestIdx++ {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			if deduplicator.Record(suite.labels, 1000, 1) {
+				atomic.AddInt32(&recorded, 1)
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	// only one of the requests ingests the sample
+	suite.Require().Equal(int32(1), recorded)
+}
+
+func (suite *dedupSuite) TestFailedSampleRetried() {
+	appender := &testAppender{}
+	options := &Options{
+		Deduplicator:          suite.newDeduplicator(time.Minute, 10),
+		MonotonicityValidator: NewMonotonicityValidator([]string{"requests"}, 10),
+	}
+
+	request := func(sampleValue float64) map[string]interface{} {
+		return map[string]interface{}{
+			"metric":  "requests",
+			"samples": []interface{}{map[string]interface{}{"t": "2000", "v": map[string]interface{}{"n": sampleValue}}},
+		}
+	}
+
+	ingest(options, appender, map[string]interface{}{
+		"metric":  "requests",
+		"samples": []interface{}{map[string]interface{}{"t": "1000", "v": map[string]interface{}{"n": 5}}},
+	})
+
+	// rejected, so not remembered as ingested
+	ingest(options, appender, request(4))
+	suite.Require().Len(appender.samples, 1)
+
+	options.MonotonicityValidator = nil
+	ingest(options, appender, request(4))
+	suite.Require().Len(appender.samples, 2)
+
+	// ingested, so remembered
+	ingest(options, appender, request(4))
+	suite.Require().Len(appender.samples, 2)
+}
+
+func (suite *dedupSuite) TestAssignedTimestamps() {
+	timestamps := timestampAssigner{now: func() time.Time {
+		return suite.now
+	}}
+
+	// samples assigned in the same millisecond are a millisecond apart
+	suite.Require().Equal(int64(1000000), timestamps.assign())
+	suite.Require().Equal(int64(1000001), timestamps.assign())
+
+	suite.now = suite.now.Add(time.Second)
+	suite.Require().Equal(int64(1001000), timestamps.assign())
+}
+
+func (suite *dedupSuite) newDeduplicator(window time.Duration, maxSamples int) *Deduplicator {
+	return NewDeduplicator(window, maxSamples, func() time.Time {
+		return suite.now
+	})
+}
+
+func TestDedupSuite(t *testing.T) {
+	suite.Run(t, new(dedupSuite))
+}
@@ -30,12 +30,32 @@ Example event:
 					"n": 86.8
 				}
 			}
-		]
+		],
+		"verbose": true
 }
+
+A metric whose histogram buckets are configured can have histogram samples, holding the number of
+observations in each bucket (followed by the number of observations above the largest bound):
+
+{
+		"t": "1532595945142",
+		"v": {
+			"h": {"counts": [120, 40, 3, 1], "sum": 31.7}
+		}
+}
+
+When "verbose" is set, the response holds the outcome of each sample (a request whose sample is rejected
+fails with the outcomes up to the rejected sample):
+
+[
+		{"t": 1532595945142, "partition": "mytsdb/1532563200/", "chunk": 10, "status": "added"},
+		{"t": 1532595948517, "partition": "mytsdb/1532563200/", "chunk": 10, "status": "added"}
+]
 */
 
 type value struct {
-	N *float64 `json:"n"`
+	N *float64   `json:"n"`
+	H *histogram `json:"h"`
 }
 
 type sample struct {
@@ -47,10 +67,28 @@ type request struct {
 	Metric  *string           `json:"metric"`
 	Labels  map[string]string `json:"labels"`
 	Samples []sample          `json:"samples"`
+	Verbose bool              `json:"verbose"`
+}
+
+// sample statuses, as reported in verbose mode
+const (
+	sampleStatusAdded    = "added"
+	sampleStatusRejected = "rejected"
+	sampleStatusDeduped  = "deduped"
+)
+
+type sampleResult struct {
+	Time      int64  `json:"t"`
+	Partition string `json:"partition,omitempty"`
+	Chunk     int    `json:"chunk,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
 }
 
 //implements InputFormat
-type defaultTsdb struct{}
+type defaultTsdb struct {
+	options *Options
+}
 
 func (Ingester defaultTsdb) Ingest(tsdbAppender tsdb.Appender, event nuclio.Event) interface{} {
 	var request request
@@ -73,40 +111,151 @@ func (Ingester defaultTsdb) Ingest(tsdbAppender tsdb.Appender, event nuclio.Even
 	labels := getLabelsFromRequest(*request.Metric, request.Labels)
 
 	var ref uint64
+	var sampleResults []sampleResult
+	timestamps := timestampAssigner{now: Ingester.options.now}
+
+	// in verbose mode, samples are located by the table's current schema
+	var partitions *schemaPartitions
+	if request.Verbose && Ingester.options.PartitionLocator != nil {
+		var err error
+
+		partitions, err = Ingester.options.PartitionLocator.readPartitions()
+		if err != nil {
+			return InternalError(errors.Wrap(err, "Failed to read partitions").Error())
+		}
+	}
+
 	// iterate over request samples
 	for _, sample := range request.Samples {
 
-		if sample.Time == nil {
+		if sample.Time == nil && !Ingester.options.AssignTimestamps {
 			return BadRequest("Missing attribute in sample: t")
 		}
 		if sample.Value == nil {
 			return BadRequest("Missing attribute in sample: v")
 		}
-		if sample.Value.N == nil {
+		if sample.Value.N == nil && sample.Value.H == nil {
 			return BadRequest("Missing attribute in sample value: n")
 		}
 
-		var time = *sample.Time
-		// if time is not specified assume "now"
-		if time == "" {
-			time = "now"
+		var sampleTime int64
+		var err error
+
+		if Ingester.options.AssignTimestamps && (sample.Time == nil || *sample.Time == "" || *sample.Time == "0") {
+			sampleTime = timestamps.assign()
+		} else {
+			var time = *sample.Time
+			// if time is not specified assume "now"
+			if time == "" {
+				time = "now"
+			}
+
+			// convert time string to time int, string can be: now, now-2h, int (unix milisec time), or RFC3339 date string
+			sampleTime, err = utils.Str2unixTimeAt(time, Ingester.options.now())
+			if err != nil {
+				return BadRequest(errors.Wrap(err, "Failed to parse time: "+time).Error())
+			}
 		}
 
-		// convert time string to time int, string can be: now, now-2h, int (unix milisec time), or RFC3339 date string
-		sampleTime, err := utils.Str2unixTime(time)
-		if err != nil {
-			return BadRequest(errors.Wrap(err, "Failed to parse time: "+time).Error())
+		// histograms are stored as several series, and aren't scaled or validated
+		if sample.Value.H != nil {
+			err = addHistogram(tsdbAppender, Ingester.options, *request.Metric, request.Labels, sampleTime, sample.Value.H)
+			if err != nil {
+				return rejectSample(request.Verbose, sampleResults, sampleTime, errors.Wrap(err, "Failed to add histogram sample"))
+			}
+
+			if request.Verbose {
+				sampleResults = append(sampleResults, getSampleResult(partitions, sampleTime))
+			}
+
+			continue
+		}
+
+		sampleValue := scaleSample(Ingester.options, *request.Metric, *sample.Value.N)
+
+		// re-ingesting a sample is a no-op
+		if !recordSample(Ingester.options, labels, sampleTime, sampleValue) {
+			if request.Verbose {
+				sampleResults = append(sampleResults, sampleResult{Time: sampleTime, Status: sampleStatusDeduped})
+			}
+
+			continue
 		}
 
+		err = validateSample(Ingester.options, *request.Metric, labels, sampleTime, sampleValue)
+
 		// append sample to metric
-		if ref == 0 {
-			ref, err = tsdbAppender.Add(labels, sampleTime, *sample.Value.N)
-		} else {
-			err = tsdbAppender.AddFast(labels, ref, sampleTime, *sample.Value.N)
+		if err == nil {
+			if ref == 0 {
+				ref, err = tsdbAppender.Add(labels, sampleTime, sampleValue)
+			} else {
+				err = tsdbAppender.AddFast(labels, ref, sampleTime, sampleValue)
+			}
 		}
 		if err != nil {
-			return BadRequest(errors.Wrap(err, "Failed to add sample").Error())
+			forgetSample(Ingester.options, labels, sampleTime, sampleValue)
+			return rejectSample(request.Verbose, sampleResults, sampleTime, errors.Wrap(err, "Failed to add sample"))
+		}
+
+		if request.Verbose {
+			sampleResults = append(sampleResults, getSampleResult(partitions, sampleTime))
 		}
 	}
+
+	if request.Verbose {
+		return sampleResultsResponse(200, sampleResults)
+	}
+
 	return nil
 }
+
+// getSampleResult returns the result of an added sample, locating it in the partitions if they were read
+func getSampleResult(partitions *schemaPartitions, sampleTime int64) sampleResult {
+	result := sampleResult{
+		Time:   sampleTime,
+		Status: sampleStatusAdded,
+	}
+
+	if partitions == nil {
+		return result
+	}
+
+	partitionPath, chunkID, err := partitions.locate(sampleTime)
+	if err != nil {
+		result.Error = errors.Wrap(err, "Failed to locate partition").Error()
+	}
+
+	result.Partition = partitionPath
+	result.Chunk = chunkID
+
+	return result
+}
+
+// rejectSample fails the request on a sample that failed to be added, like in non verbose mode. in verbose
+// mode, the response holds the results of the samples up to the rejected one
+func rejectSample(verbose bool, sampleResults []sampleResult, sampleTime int64, err error) nuclio.Response {
+	if !verbose {
+		return BadRequest(err.Error())
+	}
+
+	sampleResults = append(sampleResults, sampleResult{
+		Time:   sampleTime,
+		Status: sampleStatusRejected,
+		Error:  err.Error(),
+	})
+
+	return sampleResultsResponse(400, sampleResults)
+}
+
+func sampleResultsResponse(statusCode int, sampleResults []sampleResult) nuclio.Response {
+	body, err := json.Marshal(sampleResults)
+	if err != nil {
+		return InternalError(errors.Wrap(err, "Failed to serialize sample results").Error())
+	}
+
+	return nuclio.Response{
+		StatusCode:  statusCode,
+		ContentType: "application/json",
+		Body:        body,
+	}
+}
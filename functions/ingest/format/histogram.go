@@ -0,0 +1,95 @@
+package format
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/v3io/v3io-tsdb/pkg/tsdb"
+)
+
+// a histogram of metric m is stored Prometheus style, as the series m_bucket (one per bucket, labeled by
+// its upper bound as le, holding the cumulative count of observations up to the bound), m_count and m_sum
+const (
+	histogramBucketSuffix = "_bucket"
+	histogramCountSuffix  = "_count"
+	histogramSumSuffix    = "_sum"
+	histogramBucketLabel  = "le"
+	histogramInfBound     = "+Inf"
+)
+
+type histogram struct {
+
+	// the number of observations in each bucket (not cumulative), in the order of the metric's bucket
+	// bounds, followed by the number of observations above the largest bound
+	Counts []float64 `json:"counts"`
+	Sum    *float64  `json:"sum"`
+}
+
+// ValidateHistogramBuckets checks that the upper bounds of a metric's buckets are finite and ascending
+func ValidateHistogramBuckets(metricName string, bounds []float64) error {
+	for boundIdx, bound := range bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("Histogram bucket bound of metric %s is not finite: %v", metricName, bound)
+		}
+
+		if boundIdx != 0 && bound <= bounds[boundIdx-1] {
+			return fmt.Errorf("Histogram bucket bounds of metric %s are not ascending", metricName)
+		}
+	}
+
+	return nil
+}
+
+// addHistogram stores a histogram sample as the bucket, count and sum series of the metric
+func addHistogram(tsdbAppender tsdb.Appender,
+	options *Options,
+	metricName string,
+	labels map[string]string,
+	sampleTime int64,
+	sampleHistogram *histogram) error {
+
+	bounds, found := options.HistogramBuckets[metricName]
+	if !found {
+		return fmt.Errorf("Metric %s has no histogram buckets configured", metricName)
+	}
+
+	if len(sampleHistogram.Counts) != len(bounds)+1 {
+		return fmt.Errorf("Histogram of metric %s has %d counts rather than %d (one per bucket and one above the largest bound)",
+			metricName, len(sampleHistogram.Counts), len(bounds)+1)
+	}
+
+	bucketLabels := make(map[string]string, len(labels)+1)
+	for labelName, labelValue := range labels {
+		bucketLabels[labelName] = labelValue
+	}
+
+	var cumulativeCount float64
+	for countIdx, count := range sampleHistogram.Counts {
+		cumulativeCount += count
+
+		bucketLabels[histogramBucketLabel] = histogramInfBound
+		if countIdx < len(bounds) {
+			bucketLabels[histogramBucketLabel] = strconv.FormatFloat(bounds[countIdx], 'g', -1, 64)
+		}
+
+		bucketMetricName := metricName + histogramBucketSuffix
+		_, err := tsdbAppender.Add(getLabelsFromRequest(bucketMetricName, bucketLabels), sampleTime, cumulativeCount)
+		if err != nil {
+			return err
+		}
+	}
+
+	countMetricName := metricName + histogramCountSuffix
+	_, err := tsdbAppender.Add(getLabelsFromRequest(countMetricName, labels), sampleTime, cumulativeCount)
+	if err != nil {
+		return err
+	}
+
+	if sampleHistogram.Sum != nil {
+		sumMetricName := metricName + histogramSumSuffix
+		_, err = tsdbAppender.Add(getLabelsFromRequest(sumMetricName, labels), sampleTime, *sampleHistogram.Sum)
+	}
+
+	return err
+}
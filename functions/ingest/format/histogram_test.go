@@ -0,0 +1,87 @@
+// +build unit
+
+package format
+
+import (
+	"testing"
+
+	"github.com/nuclio/nuclio-sdk-go"
+	"github.com/stretchr/testify/suite"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type histogramSuite struct {
+	suite.Suite
+	options  *Options
+	appender *testAppender
+}
+
+func (suite *histogramSuite) SetupTest() {
+	suite.options = &Options{HistogramBuckets: map[string][]float64{"latency": {0.1, 0.5, 1}}}
+	suite.appender = &testAppender{}
+}
+
+func (suite *histogramSuite) TestHistogramStoredAsSeries() {
+	response := ingest(suite.options, suite.appender, map[string]interface{}{
+		"metric": "latency",
+		"labels": map[string]string{"host": "a"},
+		"samples": []interface{}{
+			map[string]interface{}{"t": "1000", "v": map[string]interface{}{"h": map[string]interface{}{
+				"counts": []float64{50, 40, 10, 1},
+				"sum":    31.7,
+			}}},
+		},
+	})
+
+	suite.Require().Nil(response)
+
+	expectedSamples := []struct {
+		labels []string
+		value  float64
+	}{
+		{[]string{"__name__", "latency_bucket", "host", "a", "le", "0.1"}, 50},
+		{[]string{"__name__", "latency_bucket", "host", "a", "le", "0.5"}, 90},
+		{[]string{"__name__", "latency_bucket", "host", "a", "le", "1"}, 100},
+		{[]string{"__name__", "latency_bucket", "host", "a", "le", "+Inf"}, 101},
+		{[]string{"__name__", "latency_count", "host", "a"}, 101},
+		{[]string{"__name__", "latency_sum", "host", "a"}, 31.7},
+	}
+
+	suite.Require().Len(suite.appender.samples, len(expectedSamples))
+
+	for sampleIdx, expectedSample := range expectedSamples {
+		sample := suite.appender.samples[sampleIdx]
+		suite.Require().Equal(utils.LabelsFromStringList(expectedSample.labels...).String(), sample.labels.String())
+		suite.Require().Equal(int64(1000), sample.time)
+		suite.Require().Equal(expectedSample.value, sample.value)
+	}
+}
+
+func (suite *histogramSuite) TestMismatchedCountsRejected() {
+	response := ingest(suite.options, suite.appender, map[string]interface{}{
+		"metric":  "latency",
+		"samples": []interface{}{map[string]interface{}{"t": "1000", "v": map[string]interface{}{"h": map[string]interface{}{"counts": []float64{1, 2}}}}},
+	})
+
+	suite.Require().Equal(400, response.(nuclio.Response).StatusCode)
+	suite.Require().Empty(suite.appender.samples)
+}
+
+func (suite *histogramSuite) TestUnconfiguredMetricRejected() {
+	response := ingest(suite.options, suite.appender, map[string]interface{}{
+		"metric":  "size",
+		"samples": []interface{}{map[string]interface{}{"t": "1000", "v": map[string]interface{}{"h": map[string]interface{}{"counts": []float64{1}}}}},
+	})
+
+	suite.Require().Equal(400, response.(nuclio.Response).StatusCode)
+}
+
+func (suite *histogramSuite) TestValidateHistogramBuckets() {
+	suite.Require().NoError(ValidateHistogramBuckets("latency", []float64{0.1, 0.5, 1}))
+	suite.Require().Error(ValidateHistogramBuckets("latency", []float64{0.5, 0.1}))
+	suite.Require().Error(ValidateHistogramBuckets("latency", []float64{0.1, 0.1}))
+}
+
+func TestHistogramSuite(t *testing.T) {
+	suite.Run(t, new(histogramSuite))
+}
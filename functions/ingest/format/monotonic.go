@@ -0,0 +1,86 @@
+package format
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type lastSample struct {
+	seriesHash uint64
+	time       int64
+	value      float64
+}
+
+// MonotonicityValidator rejects samples of counter metrics whose value is lower than the value of the
+// latest sample of the same series. Samples older than the latest sample (e.g. backfill) aren't checked.
+// The latest samples are kept in memory, so a decrease is only detected by the function replica that
+// ingested the sample before it (its workers should share one MonotonicityValidator, for a decrease to be
+// detected whichever of them ingest the samples) - decreases across replicas (or across restarts) aren't
+// detected. At most
+// maxSeries series are remembered (the least recently ingested are forgotten first), and the first sample
+// of a series that isn't remembered isn't checked
+type MonotonicityValidator struct {
+	counterMetrics map[string]bool
+	maxSeries      int
+	lastSamples    map[uint64]*list.Element
+	order          *list.List
+	lock           sync.Mutex
+}
+
+func NewMonotonicityValidator(counterMetrics []string, maxSeries int) *MonotonicityValidator {
+	newMonotonicityValidator := &MonotonicityValidator{
+		counterMetrics: map[string]bool{},
+		maxSeries:      maxSeries,
+		lastSamples:    map[uint64]*list.Element{},
+		order:          list.New(),
+	}
+
+	for _, counterMetric := range counterMetrics {
+		newMonotonicityValidator.counterMetrics[counterMetric] = true
+	}
+
+	return newMonotonicityValidator
+}
+
+// Validate returns an error if the sample decreases the value of a counter
+func (mv *MonotonicityValidator) Validate(metricName string, labels utils.Labels, sampleTime int64, sampleValue float64) error {
+	if !mv.counterMetrics[metricName] {
+		return nil
+	}
+
+	hash := labels.Hash()
+
+	mv.lock.Lock()
+	defer mv.lock.Unlock()
+
+	element, found := mv.lastSamples[hash]
+	if !found {
+		mv.lastSamples[hash] = mv.order.PushBack(&lastSample{seriesHash: hash, time: sampleTime, value: sampleValue})
+
+		for mv.order.Len() > mv.maxSeries {
+			delete(mv.lastSamples, mv.order.Remove(mv.order.Front()).(*lastSample).seriesHash)
+		}
+
+		return nil
+	}
+
+	last := element.Value.(*lastSample)
+	mv.order.MoveToBack(element)
+
+	if sampleTime < last.time {
+		return nil
+	}
+
+	if sampleValue < last.value {
+		return fmt.Errorf("Counter %s decreased from %v (at %d) to %v (at %d)",
+			labels.String(), last.value, last.time, sampleValue, sampleTime)
+	}
+
+	last.time = sampleTime
+	last.value = sampleValue
+
+	return nil
+}
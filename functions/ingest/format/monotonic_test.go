@@ -0,0 +1,59 @@
+// +build unit
+
+package format
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type monotonicSuite struct {
+	suite.Suite
+}
+
+func (suite *monotonicSuite) TestCounterDecreaseRejected() {
+	validator := NewMonotonicityValidator([]string{"requests"}, 10)
+	labels := utils.LabelsFromStringList("__name__", "requests", "host", "a")
+
+	suite.Require().NoError(validator.Validate("requests", labels, 1000, 5))
+	suite.Require().NoError(validator.Validate("requests", labels, 2000, 5))
+	suite.Require().Error(validator.Validate("requests", labels, 3000, 4))
+
+	// older samples (e.g. backfill) aren't checked
+	suite.Require().NoError(validator.Validate("requests", labels, 500, 1))
+
+	// the rejected sample isn't remembered
+	suite.Require().NoError(validator.Validate("requests", labels, 3000, 6))
+}
+
+func (suite *monotonicSuite) TestGaugeAllowed() {
+	validator := NewMonotonicityValidator([]string{"requests"}, 10)
+	labels := utils.LabelsFromStringList("__name__", "cpu", "host", "a")
+
+	suite.Require().NoError(validator.Validate("cpu", labels, 1000, 5))
+	suite.Require().NoError(validator.Validate("cpu", labels, 2000, 4))
+}
+
+func (suite *monotonicSuite) TestLeastRecentSeriesForgotten() {
+	validator := NewMonotonicityValidator([]string{"requests"}, 2)
+	hostA := utils.LabelsFromStringList("__name__", "requests", "host", "a")
+	hostB := utils.LabelsFromStringList("__name__", "requests", "host", "b")
+	hostC := utils.LabelsFromStringList("__name__", "requests", "host", "c")
+
+	suite.Require().NoError(validator.Validate("requests", hostA, 1000, 5))
+	suite.Require().NoError(validator.Validate("requests", hostB, 1000, 5))
+
+	// ingesting a makes b the least recently ingested series
+	suite.Require().NoError(validator.Validate("requests", hostA, 2000, 6))
+	suite.Require().NoError(validator.Validate("requests", hostC, 1000, 5))
+
+	// b was forgotten, so its decrease isn't detected, while c is still remembered
+	suite.Require().NoError(validator.Validate("requests", hostB, 2000, 1))
+	suite.Require().Error(validator.Validate("requests", hostC, 2000, 1))
+}
+
+func TestMonotonicSuite(t *testing.T) {
+	suite.Run(t, new(monotonicSuite))
+}
@@ -0,0 +1,85 @@
+package format
+
+import (
+	"path"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/v3io/v3io-tsdb/pkg/config"
+	"github.com/v3io/v3io-tsdb/pkg/partmgr"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+// PartitionLocator resolves the partition and chunk a sample is stored in, by the table's current schema.
+// Unlike the appender's partition manager, it never creates partitions or updates the schema
+type PartitionLocator struct {
+	tablePath  string
+	readSchema func() (*config.Schema, error)
+}
+
+func NewPartitionLocator(tablePath string, readSchema func() (*config.Schema, error)) *PartitionLocator {
+	return &PartitionLocator{
+		tablePath:  tablePath,
+		readSchema: readSchema,
+	}
+}
+
+// schemaPartitions holds the partitions of a table's schema, as read at some point
+type schemaPartitions struct {
+	partitionManager  *partmgr.PartitionManager
+	partitionInterval int64
+}
+
+// readPartitions reads the table's current schema, so that partitions created since the function started
+// (possibly by other replicas, and with a different interval) are located
+func (pl *PartitionLocator) readPartitions() (*schemaPartitions, error) {
+	schema, err := pl.readSchema()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read schema")
+	}
+
+	partitionInterval, err := utils.Str2duration(schema.PartitionSchemaInfo.PartitionerInterval)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse partition interval")
+	}
+
+	// the partition manager is only used to read the partitions from the schema - it has no container
+	partitionManager, err := partmgr.NewPartitionMngr(schema, nil, &config.V3ioConfig{TablePath: pl.tablePath})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create partition manager")
+	}
+
+	return &schemaPartitions{
+		partitionManager:  partitionManager,
+		partitionInterval: partitionInterval,
+	}, nil
+}
+
+// locate returns the path of the partition and the ID of the chunk that hold a sample with the given time
+func (sp *schemaPartitions) locate(sampleTime int64) (string, int, error) {
+	var partition *partmgr.DBPartition
+
+	// prefer partitions which already exist in the schema, since they may have been created with
+	// a different interval
+	if partitions := sp.partitionManager.PartsForRange(sampleTime, sampleTime, true); len(partitions) > 0 {
+		partition = partitions[0]
+	} else {
+
+		// round the time the same way the partition manager does when creating a partition
+		startTime := (sp.partitionInterval * (sampleTime / sp.partitionInterval)) & 0x7FFFFFFFFFFFFFF0
+		partitionPath := path.Join(sp.partitionManager.Path(), strconv.FormatInt(startTime/1000, 10)) + "/"
+
+		var err error
+		partition, err = partmgr.NewDBPartition(sp.partitionManager, startTime, partitionPath)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	chunkID, err := partition.TimeToChunkId(sampleTime)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return partition.GetTablePath(), chunkID, nil
+}
@@ -0,0 +1,138 @@
+// +build unit
+
+package format
+
+import (
+	"encoding/json"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk-go"
+	"github.com/stretchr/testify/suite"
+	"github.com/v3io/v3io-tsdb/pkg/config"
+	"github.com/v3io/v3io-tsdb/pkg/tsdb/schema"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type placementSuite struct {
+	suite.Suite
+	schema            *config.Schema
+	partitionInterval int64
+	options           *Options
+	appender          *testAppender
+}
+
+func (suite *placementSuite) SetupTest() {
+	v3ioConfig, err := config.GetOrLoadFromStruct(&config.V3ioConfig{TablePath: "mytsdb"})
+	suite.Require().NoError(err)
+
+	suite.schema, err = schema.NewSchema(v3ioConfig, "1/s", "1h", "", "")
+	suite.Require().NoError(err)
+
+	suite.partitionInterval, err = utils.Str2duration(suite.schema.PartitionSchemaInfo.PartitionerInterval)
+	suite.Require().NoError(err)
+
+	suite.options = &Options{
+		PartitionLocator: NewPartitionLocator("mytsdb", func() (*config.Schema, error) {
+			return suite.schema, nil
+		}),
+	}
+	suite.appender = &testAppender{}
+}
+
+func (suite *placementSuite) TestPartitionMatchesTime() {
+	sampleTimes := []int64{1532595944000, 1532595944000 + suite.partitionInterval}
+	results := suite.ingestVerbose(200, sampleTimes...)
+
+	suite.Require().Len(results, 2)
+
+	for resultIdx, result := range results {
+		partitionStartTime := suite.partitionInterval * (sampleTimes[resultIdx] / suite.partitionInterval)
+
+		suite.Require().Equal(sampleTimes[resultIdx], result.Time)
+		suite.Require().Equal(sampleStatusAdded, result.Status)
+		suite.Require().Equal(suite.partitionPath(partitionStartTime), result.Partition)
+	}
+}
+
+func (suite *placementSuite) TestCurrentSchemaRead() {
+	sampleTime := int64(1532595944000)
+
+	// a partition created (e.g. by another replica) after the locator was, which doesn't start at a
+	// multiple of the partition interval
+	partitionStartTime := sampleTime - 16000
+	suite.schema.Partitions = append(suite.schema.Partitions, &config.Partition{
+		StartTime:  partitionStartTime,
+		SchemaInfo: suite.schema.PartitionSchemaInfo,
+	})
+
+	results := suite.ingestVerbose(200, sampleTime)
+	suite.Require().Len(results, 1)
+	suite.Require().Equal(suite.partitionPath(partitionStartTime), results[0].Partition)
+}
+
+func (suite *placementSuite) TestDedupedAndRejected() {
+	suite.options.Deduplicator = NewDeduplicator(time.Hour, 10, time.Now)
+	suite.options.MonotonicityValidator = NewMonotonicityValidator([]string{"cpu"}, 10)
+
+	results := suite.ingestVerbose(200, 1000)
+	suite.Require().Equal(sampleStatusAdded, results[0].Status)
+
+	// re-ingesting the sample is reported as deduped, and the request fails on the rejected sample
+	// (the counter decreases), like it does without verbose
+	response := ingest(suite.options, suite.appender, map[string]interface{}{
+		"metric": "cpu",
+		"samples": []interface{}{
+			map[string]interface{}{"t": "1000", "v": map[string]interface{}{"n": 1}},
+			map[string]interface{}{"t": "2000", "v": map[string]interface{}{"n": 0}},
+			map[string]interface{}{"t": "3000", "v": map[string]interface{}{"n": 2}},
+		},
+		"verbose": true,
+	}).(nuclio.Response)
+
+	suite.Require().Equal(400, response.StatusCode)
+
+	results = nil
+	suite.Require().NoError(json.Unmarshal(response.Body, &results))
+	suite.Require().Len(results, 2)
+	suite.Require().Equal(sampleStatusDeduped, results[0].Status)
+	suite.Require().Equal(sampleStatusRejected, results[1].Status)
+	suite.Require().NotEmpty(results[1].Error)
+
+	// the sample after the rejected one isn't ingested
+	suite.Require().Len(suite.appender.samples, 1)
+}
+
+// ingestVerbose ingests a sample of value 1 at each of the given times in verbose mode, returning the results
+func (suite *placementSuite) ingestVerbose(expectedStatusCode int, sampleTimes ...int64) []sampleResult {
+	var samples []interface{}
+	for _, sampleTime := range sampleTimes {
+		samples = append(samples, map[string]interface{}{
+			"t": strconv.FormatInt(sampleTime, 10),
+			"v": map[string]interface{}{"n": 1},
+		})
+	}
+
+	response := ingest(suite.options, suite.appender, map[string]interface{}{
+		"metric":  "cpu",
+		"samples": samples,
+		"verbose": true,
+	}).(nuclio.Response)
+
+	suite.Require().Equal(expectedStatusCode, response.StatusCode)
+
+	var results []sampleResult
+	suite.Require().NoError(json.Unmarshal(response.Body, &results))
+
+	return results
+}
+
+func (suite *placementSuite) partitionPath(partitionStartTime int64) string {
+	return path.Join("mytsdb", strconv.FormatInt(partitionStartTime/1000, 10)) + "/"
+}
+
+func TestPlacementSuite(t *testing.T) {
+	suite.Run(t, new(placementSuite))
+}
@@ -0,0 +1,37 @@
+package format
+
+import (
+	"fmt"
+	"math"
+)
+
+// ValueScaler converts the values of metrics to their canonical unit (e.g. bytes to MB) by multiplying
+// them by a per metric factor. Values are not rounded, so the stored value is the float64 product of the
+// sample value and the factor (e.g. a factor of 0.000001 may store 1.5 as 1.4999999999999998e-06)
+type ValueScaler struct {
+	factors map[string]float64
+}
+
+func NewValueScaler(factors map[string]float64) *ValueScaler {
+	return &ValueScaler{
+		factors: factors,
+	}
+}
+
+// ValidateScaleFactor checks that a metric's scale factor is a finite number other than 0
+func ValidateScaleFactor(metricName string, factor float64) error {
+	if factor == 0 || math.IsNaN(factor) || math.IsInf(factor, 0) {
+		return fmt.Errorf("Invalid scale factor of metric %s: %v", metricName, factor)
+	}
+
+	return nil
+}
+
+// Scale returns the value of a sample in the canonical unit of its metric
+func (vs *ValueScaler) Scale(metricName string, sampleValue float64) float64 {
+	if factor, found := vs.factors[metricName]; found {
+		return sampleValue * factor
+	}
+
+	return sampleValue
+}
@@ -0,0 +1,50 @@
+// +build unit
+
+package format
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type scalingSuite struct {
+	suite.Suite
+}
+
+func (suite *scalingSuite) TestScaledBeforeValidation() {
+	appender := &testAppender{}
+	options := &Options{
+		ValueScaler:           NewValueScaler(map[string]float64{"disk_used": 0.001}),
+		MonotonicityValidator: NewMonotonicityValidator([]string{"disk_used"}, 10),
+	}
+
+	response := ingest(options, appender, map[string]interface{}{
+		"metric": "disk_used",
+		"samples": []interface{}{
+			map[string]interface{}{"t": "1000", "v": map[string]interface{}{"n": 2000}},
+			map[string]interface{}{"t": "2000", "v": map[string]interface{}{"n": 3000}},
+		},
+	})
+
+	suite.Require().Nil(response)
+	suite.Require().Len(appender.samples, 2)
+	suite.Require().Equal(float64(2), appender.samples[0].value)
+	suite.Require().Equal(float64(3), appender.samples[1].value)
+
+	// other metrics aren't scaled
+	suite.Require().Equal(float64(2000), options.ValueScaler.Scale("cpu", 2000))
+}
+
+func (suite *scalingSuite) TestValidateScaleFactor() {
+	suite.Require().NoError(ValidateScaleFactor("disk_used", 0.000001))
+
+	for _, factor := range []float64{0, math.NaN(), math.Inf(1)} {
+		suite.Require().Error(ValidateScaleFactor("disk_used", factor))
+	}
+}
+
+func TestScalingSuite(t *testing.T) {
+	suite.Run(t, new(scalingSuite))
+}
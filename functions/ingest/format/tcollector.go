@@ -23,7 +23,9 @@ type tInfo struct {
 }
 
 //implements InputFormat
-type tcollectorFormat struct{}
+type tcollectorFormat struct {
+	options *Options
+}
 
 func (Ingester tcollectorFormat) Ingest(tsdbAppender tsdb.Appender, event nuclio.Event) interface{} {
 
@@ -36,12 +38,16 @@ func (Ingester tcollectorFormat) Ingest(tsdbAppender tsdb.Appender, event nuclio
 	}
 
 	var errBuilder strings.Builder
+	timestamps := timestampAssigner{now: Ingester.options.now}
 	for _, tinfo := range tinfos {
 
 		metric := strings.Replace(tinfo.Metric, ".", "_", -1)
 
 		sampleTime := tinfo.Timestamp * 1000
-		sampleValue := tinfo.Value
+		if sampleTime == 0 && Ingester.options.AssignTimestamps {
+			sampleTime = timestamps.assign()
+		}
+		sampleValue := scaleSample(Ingester.options, metric, tinfo.Value)
 
 		tagMap := make(map[string]string, len(tinfo.Tags))
 		for k, v := range tinfo.Tags {
@@ -50,8 +56,17 @@ func (Ingester tcollectorFormat) Ingest(tsdbAppender tsdb.Appender, event nuclio
 		// convert the map[string]string -> []Labels
 		labels := getLabelsFromRequest(metric, tagMap)
 
-		_, err := tsdbAppender.Add(labels, sampleTime, sampleValue)
+		// re-ingesting a sample is a no-op
+		if !recordSample(Ingester.options, labels, sampleTime, sampleValue) {
+			continue
+		}
+
+		err := validateSample(Ingester.options, metric, labels, sampleTime, sampleValue)
+		if err == nil {
+			_, err = tsdbAppender.Add(labels, sampleTime, sampleValue)
+		}
 		if err != nil {
+			forgetSample(Ingester.options, labels, sampleTime, sampleValue)
 			errBuilder.WriteString(fmt.Sprintf("Failed to add samples for metric %s and labels %+v:\n ", tinfo.Metric, labels))
 			errBuilder.WriteString(err.Error())
 			errBuilder.WriteString("\n*********************************************************************\n")
@@ -0,0 +1,63 @@
+// +build unit
+
+package format
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk-go"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type testEvent struct {
+	nuclio.AbstractEvent
+	body []byte
+}
+
+func (te *testEvent) GetBody() []byte {
+	return te.body
+}
+
+type testSample struct {
+	labels utils.Labels
+	time   int64
+	value  interface{}
+}
+
+// testAppender records the samples added to it
+type testAppender struct {
+	samples []testSample
+}
+
+func (ta *testAppender) Add(labels utils.Labels, sampleTime int64, sampleValue interface{}) (uint64, error) {
+	ta.samples = append(ta.samples, testSample{labels: labels, time: sampleTime, value: sampleValue})
+	return uint64(len(ta.samples)), nil
+}
+
+func (ta *testAppender) AddFast(labels utils.Labels, ref uint64, sampleTime int64, sampleValue interface{}) error {
+	_, err := ta.Add(labels, sampleTime, sampleValue)
+	return err
+}
+
+func (ta *testAppender) WaitForCompletion(timeout time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (ta *testAppender) Commit() error {
+	return nil
+}
+
+func (ta *testAppender) Rollback() error {
+	return nil
+}
+
+// ingest ingests a request of the default format, returning the response
+func ingest(options *Options, appender *testAppender, request interface{}) interface{} {
+	body, err := json.Marshal(request)
+	if err != nil {
+		panic(err)
+	}
+
+	return IngesterForName("default", options).Ingest(appender, &testEvent{body: body})
+}
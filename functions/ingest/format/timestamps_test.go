@@ -0,0 +1,78 @@
+// +build unit
+
+package format
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type timestampsSuite struct {
+	suite.Suite
+	options *Options
+}
+
+func (suite *timestampsSuite) SetupTest() {
+	suite.options = &Options{
+		AssignTimestamps: true,
+		Now: func() time.Time {
+			return time.Unix(1000, 0)
+		},
+	}
+}
+
+func (suite *timestampsSuite) TestAssignedByClock() {
+	appender := &testAppender{}
+
+	response := ingest(suite.options, appender, map[string]interface{}{
+		"metric": "cpu",
+		"samples": []interface{}{
+			map[string]interface{}{"v": map[string]interface{}{"n": 1}},
+			map[string]interface{}{"t": "", "v": map[string]interface{}{"n": 2}},
+			map[string]interface{}{"t": "5000", "v": map[string]interface{}{"n": 3}},
+		},
+	})
+
+	suite.Require().Nil(response)
+
+	// the samples without a time are assigned the clock's time, a millisecond apart, while the one that has
+	// a time keeps it
+	suite.Require().Len(appender.samples, 3)
+	suite.Require().Equal(int64(1000000), appender.samples[0].time)
+	suite.Require().Equal(int64(1000001), appender.samples[1].time)
+	suite.Require().Equal(int64(5000), appender.samples[2].time)
+}
+
+func (suite *timestampsSuite) TestTcollectorAssignedByClock() {
+	appender := &testAppender{}
+
+	body, err := json.Marshal([]interface{}{
+		map[string]interface{}{"metric": "cpu", "value": 1, "tags": map[string]string{"host": "a"}},
+		map[string]interface{}{"metric": "cpu", "value": 2, "tags": map[string]string{"host": "b"}, "timestamp": 5},
+	})
+	suite.Require().NoError(err)
+
+	IngesterForName(tcollector, suite.options).Ingest(appender, &testEvent{body: body})
+
+	suite.Require().Len(appender.samples, 2)
+	suite.Require().Equal(int64(1000000), appender.samples[0].time)
+	suite.Require().Equal(int64(5000), appender.samples[1].time)
+}
+
+func (suite *timestampsSuite) TestRequiredUnlessAssigned() {
+	suite.options.AssignTimestamps = false
+
+	response := ingest(suite.options, &testAppender{}, map[string]interface{}{
+		"metric":  "cpu",
+		"samples": []interface{}{map[string]interface{}{"v": map[string]interface{}{"n": 1}}},
+	})
+
+	suite.Require().NotNil(response)
+}
+
+func TestTimestampsSuite(t *testing.T) {
+	suite.Run(t, new(timestampsSuite))
+}
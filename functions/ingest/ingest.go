@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/nuclio/handler/format"
 	"github.com/nuclio/nuclio-sdk-go"
@@ -20,6 +21,13 @@ type UserData struct {
 var adapter *tsdb.V3ioAdapter
 var adapterLock sync.Mutex
 
+// shared by all contexts (like the adapter), so that a sample ingested by one worker is a duplicate for
+// the others
+var deduplicator *format.Deduplicator
+
+// shared by all contexts, so that a counter decrease is detected whichever workers ingest its samples
+var monotonicityValidator *format.MonotonicityValidator
+
 func Ingest(context *nuclio.Context, event nuclio.Event) (interface{}, error) {
 
 	// get user data from context, as initialized by InitContext
@@ -33,10 +41,6 @@ func InitContext(context *nuclio.Context) error {
 	var err error
 	var userData UserData
 
-	// get input format
-	formatName := os.Getenv("INPUT_FORMAT")
-	userData.ingester = format.IngesterForName(formatName)
-
 	// get configuration from env
 	tsdbAppenderPath := os.Getenv("INGEST_V3IO_TSDB_PATH")
 	if tsdbAppenderPath == "" {
@@ -51,6 +55,15 @@ func InitContext(context *nuclio.Context) error {
 		return err
 	}
 
+	ingesterOptions, err := createIngesterOptions(tsdbAppenderPath)
+	if err != nil {
+		return err
+	}
+
+	// get input format
+	formatName := os.Getenv("INPUT_FORMAT")
+	userData.ingester = format.IngesterForName(formatName, ingesterOptions)
+
 	// set user data into the context
 	context.UserData = &userData
 
@@ -105,6 +118,109 @@ func createTSDBAppender(context *nuclio.Context, path string) (tsdb.Appender, er
 	return tsdbAppender, nil
 }
 
+func createIngesterOptions(path string) (*format.Options, error) {
+	var ingesterOptions format.Options
+	var err error
+
+	// used to report where samples were stored, in verbose mode
+	ingesterOptions.PartitionLocator = format.NewPartitionLocator(path, adapter.ReadSchema)
+
+	// counters, scale factors and histogram buckets are configured per metric in the table's schema
+	var counterMetrics []string
+	scaleFactors := map[string]float64{}
+	histogramBuckets := map[string][]float64{}
+
+	for metricName, metricConfig := range adapter.GetSchema().TableSchemaInfo.Metrics {
+		if metricConfig.Monotonic {
+			counterMetrics = append(counterMetrics, metricName)
+		}
+
+		if metricConfig.ScaleFactor != 0 {
+			if err := format.ValidateScaleFactor(metricName, metricConfig.ScaleFactor); err != nil {
+				return nil, err
+			}
+
+			scaleFactors[metricName] = metricConfig.ScaleFactor
+		}
+
+		if len(metricConfig.HistogramBuckets) != 0 {
+			if err := format.ValidateHistogramBuckets(metricName, metricConfig.HistogramBuckets); err != nil {
+				return nil, err
+			}
+
+			histogramBuckets[metricName] = metricConfig.HistogramBuckets
+		}
+	}
+
+	if len(counterMetrics) != 0 {
+		ingesterOptions.MonotonicityValidator, err = getMonotonicityValidator(counterMetrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(scaleFactors) != 0 {
+		ingesterOptions.ValueScaler = format.NewValueScaler(scaleFactors)
+	}
+
+	ingesterOptions.HistogramBuckets = histogramBuckets
+
+	ingesterOptions.Deduplicator, err = getDeduplicator()
+	if err != nil {
+		return nil, err
+	}
+
+	// assign the server time to samples that have no time
+	ingesterOptions.AssignTimestamps = os.Getenv("INGEST_ASSIGN_TIMESTAMPS") == "true"
+
+	return &ingesterOptions, nil
+}
+
+// getMonotonicityValidator returns the monotonicity validator of all contexts, creating it on first use
+func getMonotonicityValidator(counterMetrics []string) (*format.MonotonicityValidator, error) {
+	adapterLock.Lock()
+	defer adapterLock.Unlock()
+
+	if monotonicityValidator != nil {
+		return monotonicityValidator, nil
+	}
+
+	maxSeries, err := toNumber(os.Getenv("INGEST_MONOTONIC_MAX_SERIES"), 100000)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get monotonic maximum series")
+	}
+
+	monotonicityValidator = format.NewMonotonicityValidator(counterMetrics, maxSeries)
+
+	return monotonicityValidator, nil
+}
+
+// getDeduplicator returns the deduplicator of all contexts, creating it on first use. nil if dedup is disabled
+func getDeduplicator() (*format.Deduplicator, error) {
+	adapterLock.Lock()
+	defer adapterLock.Unlock()
+
+	// the duration for which ingested samples are remembered, so that re-ingesting them is a no-op
+	dedupWindow := os.Getenv("INGEST_DEDUP_WINDOW")
+	if deduplicator != nil || dedupWindow == "" {
+		return deduplicator, nil
+	}
+
+	window, err := time.ParseDuration(dedupWindow)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse dedup window")
+	}
+
+	maxSamples, err := toNumber(os.Getenv("INGEST_DEDUP_MAX_SAMPLES"), 1000000)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get dedup maximum samples")
+	}
+
+	deduplicator = format.NewDeduplicator(window, maxSamples, time.Now)
+
+	return deduplicator, nil
+}
+
 func toNumber(input string, defaultValue int) (int, error) {
 	if input == "" {
 		return defaultValue, nil
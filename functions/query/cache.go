@@ -0,0 +1,120 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	key        string
+	result     string
+	expiration time.Time
+}
+
+// resultCache holds query results for a bounded time (ttl), evicting the least recently used result
+// when it holds more than maxEntries results
+type resultCache struct {
+	lock       sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+
+	// the clock against which entries expire
+	now func() time.Time
+}
+
+func newResultCache(ttl time.Duration, maxEntries int, now func() time.Time) *resultCache {
+	return &resultCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		now:        now,
+	}
+}
+
+func (rc *resultCache) get(key string) (string, bool) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	element, found := rc.entries[key]
+	if !found {
+		return "", false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if rc.now().After(entry.expiration) {
+		rc.remove(element)
+		return "", false
+	}
+
+	rc.lru.MoveToFront(element)
+
+	return entry.result, true
+}
+
+func (rc *resultCache) set(key string, result string) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	if element, found := rc.entries[key]; found {
+		rc.remove(element)
+	}
+
+	rc.entries[key] = rc.lru.PushFront(&cacheEntry{
+		key:        key,
+		result:     result,
+		expiration: rc.now().Add(rc.ttl),
+	})
+
+	for rc.lru.Len() > rc.maxEntries {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+func (rc *resultCache) remove(element *list.Element) {
+	rc.lru.Remove(element)
+	delete(rc.entries, element.Value.(*cacheEntry).key)
+}
+
+// getCacheKey normalizes a query to a key. the time range is the resolved one, so that relative times
+// are keyed by the actual range they cover (see alignToStep)
+func getCacheKey(queryRequest *request, from int64, to int64, step int64) string {
+	key, _ := json.Marshal(struct {
+		*request
+		From int64 `json:"from"`
+		To   int64 `json:"to"`
+		Step int64 `json:"step_ms"`
+	}{queryRequest, from, to, step})
+
+	return string(key)
+}
+
+// alignToStep widens a time range to whole steps. relative times (e.g. now-1h) resolve to a different
+// millisecond each time they're queried, so queries whose range is cached are aligned before they're keyed
+// and run - repeating one within the same step then hits. raw queries (a step of 0) aren't aligned, so only
+// exact repeats of their range hit
+func alignToStep(from int64, to int64, step int64) (int64, int64) {
+	if step <= 0 {
+		return from, to
+	}
+
+	from -= from % step
+	if to%step != 0 {
+		to += step - to%step
+	}
+
+	return from, to
+}
+
+// isCacheable checks whether the result of a query can be cached. the most recent bucket may still
+// get samples, so results that include it are not cached. the live edge is resolved against the clock
+// of the cache, which is that of the query's relative times
+func (rc *resultCache) isCacheable(to int64, step int64) bool {
+	liveEdge := rc.now().UnixNano()/int64(time.Millisecond) - step
+
+	return to < liveEdge
+}
@@ -0,0 +1,159 @@
+//go:build unit
+// +build unit
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk-go"
+	"github.com/nuclio/zap"
+	"github.com/stretchr/testify/suite"
+)
+
+type cacheSuite struct {
+	suite.Suite
+	now time.Time
+}
+
+func (suite *cacheSuite) SetupTest() {
+	suite.now = time.Unix(1000, 0)
+}
+
+func (suite *cacheSuite) TestHitAndMiss() {
+	cache := suite.newCache(time.Minute, 2)
+
+	_, found := cache.get("a")
+	suite.Require().False(found)
+
+	cache.set("a", "result a")
+
+	result, found := cache.get("a")
+	suite.Require().True(found)
+	suite.Require().Equal("result a", result)
+
+	// expired
+	suite.now = suite.now.Add(2 * time.Minute)
+	_, found = cache.get("a")
+	suite.Require().False(found)
+}
+
+func (suite *cacheSuite) TestEviction() {
+	cache := suite.newCache(time.Minute, 2)
+
+	cache.set("a", "result a")
+	cache.set("b", "result b")
+
+	// a is now the most recently used
+	_, found := cache.get("a")
+	suite.Require().True(found)
+
+	cache.set("c", "result c")
+
+	_, found = cache.get("b")
+	suite.Require().False(found)
+
+	for _, key := range []string{"a", "c"} {
+		_, found = cache.get(key)
+		suite.Require().True(found)
+	}
+}
+
+func (suite *cacheSuite) TestKeyResolvesRange() {
+	queryRequest := &request{Metric: "cpu", Last: "1h"}
+
+	suite.Require().Equal(getCacheKey(queryRequest, 0, 3600000, 60000), getCacheKey(queryRequest, 0, 3600000, 60000))
+	suite.Require().NotEqual(getCacheKey(queryRequest, 0, 3600000, 60000), getCacheKey(queryRequest, 60000, 3660000, 60000))
+}
+
+func (suite *cacheSuite) TestRelativeRangeKey() {
+	defer func(previousClock func() time.Time) { clock = previousClock }(clock)
+
+	queryRequest := &request{Metric: "cpu", StartTime: "now-2h", EndTime: "now-1h", Step: "1m"}
+	getKey := func(now time.Time) string {
+		clock = func() time.Time { return now }
+
+		from, to, step, err := resolveTimeRange(queryRequest)
+		suite.Require().NoError(err)
+
+		from, to = alignToStep(from, to, step)
+		suite.Require().Zero(from % step)
+		suite.Require().Zero(to % step)
+
+		return getCacheKey(queryRequest, from, to, step)
+	}
+
+	// a relative range queried again within the same step hits, and misses once the step passes
+	start := time.Unix(3600*24, 0).Add(10 * time.Second)
+	suite.Require().Equal(getKey(start), getKey(start.Add(30*time.Second)))
+	suite.Require().NotEqual(getKey(start), getKey(start.Add(time.Minute)))
+}
+
+func (suite *cacheSuite) TestAlignToStep() {
+	for _, testCase := range []struct {
+		from, to, step         int64
+		alignedFrom, alignedTo int64
+	}{
+		{from: 60000, to: 120000, step: 60000, alignedFrom: 60000, alignedTo: 120000},
+		{from: 61000, to: 119000, step: 60000, alignedFrom: 60000, alignedTo: 120000},
+		{from: 61000, to: 62000, step: 60000, alignedFrom: 60000, alignedTo: 120000},
+
+		// raw queries aren't aligned
+		{from: 61000, to: 119000, step: 0, alignedFrom: 61000, alignedTo: 119000},
+	} {
+		from, to := alignToStep(testCase.from, testCase.to, testCase.step)
+		suite.Require().Equal(testCase.alignedFrom, from)
+		suite.Require().Equal(testCase.alignedTo, to)
+	}
+}
+
+func (suite *cacheSuite) TestLiveEdgeIsNotCached() {
+	cache := suite.newCache(time.Minute, 2)
+	now := suite.now.Unix() * 1000
+
+	suite.Require().True(cache.isCacheable(now-10*60000, 60000))
+	suite.Require().False(cache.isCacheable(now, 60000))
+	suite.Require().False(cache.isCacheable(now-30000, 60000))
+
+	// the live edge moves with the clock
+	suite.now = suite.now.Add(time.Minute)
+	suite.Require().True(cache.isCacheable(now-30000, 60000))
+}
+
+func (suite *cacheSuite) TestCacheSize() {
+	logger, err := nucliozap.NewNuclioZapTest("test")
+	suite.Require().NoError(err)
+
+	context := &nuclio.Context{Logger: logger}
+
+	defer os.Unsetenv("QUERY_CACHE_TTL")
+	defer os.Unsetenv("QUERY_CACHE_SIZE")
+	os.Setenv("QUERY_CACHE_TTL", "1m")
+
+	os.Setenv("QUERY_CACHE_SIZE", "-1")
+	suite.Require().Error(createQueryCache(context))
+	suite.Require().Nil(queryCache)
+
+	os.Setenv("QUERY_CACHE_SIZE", "0")
+	suite.Require().NoError(createQueryCache(context))
+	suite.Require().Nil(queryCache)
+
+	os.Setenv("QUERY_CACHE_SIZE", "10")
+	suite.Require().NoError(createQueryCache(context))
+	suite.Require().NotNil(queryCache)
+	suite.Require().Equal(10, queryCache.maxEntries)
+
+	queryCache = nil
+}
+
+func (suite *cacheSuite) newCache(ttl time.Duration, maxEntries int) *resultCache {
+	return newResultCache(ttl, maxEntries, func() time.Time {
+		return suite.now
+	})
+}
+
+func TestCacheSuite(t *testing.T) {
+	suite.Run(t, new(cacheSuite))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Example EMA (smoothing by a half-life, over samples at any interval):
+//
+//	{
+//		"half_life": "5m"
+//	}
+type emaTransform struct {
+	Alpha    float64 `json:"alpha"`
+	HalfLife string  `json:"half_life"`
+
+	// the parsed half-life, in milliseconds
+	halfLife int64
+}
+
+func validateEMA(ema *emaTransform) error {
+	if ema == nil {
+		return nil
+	}
+
+	if (ema.Alpha == 0) == (ema.HalfLife == "") {
+		return errors.New("EMA requires either an alpha or a half-life")
+	}
+
+	if ema.HalfLife == "" {
+		if ema.Alpha <= 0 || ema.Alpha > 1 {
+			return errors.Errorf("EMA alpha must be between 0 (exclusive) and 1: %v", ema.Alpha)
+		}
+
+		return nil
+	}
+
+	halfLife, err := time.ParseDuration(ema.HalfLife)
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse EMA half-life")
+	}
+
+	if halfLife < time.Millisecond {
+		return errors.Errorf("EMA half-life must be at least 1ms: %s", ema.HalfLife)
+	}
+
+	ema.halfLife = int64(halfLife / time.Millisecond)
+
+	return nil
+}
+
+// smoothingFactor returns the weight of a point that follows the previous one by interval milliseconds. with
+// an alpha, every point has the same weight, regardless of the interval. with a half-life, the weight of the
+// average decays by half every half-life, so that irregular intervals are accounted for
+func (ema *emaTransform) smoothingFactor(interval int64) float64 {
+	if ema.halfLife == 0 {
+		return ema.Alpha
+	}
+
+	return 1 - math.Exp(-math.Ln2*float64(interval)/float64(ema.halfLife))
+}
+
+// exponentialMovingAverage smooths each series: the average starts at the value of the first point, and
+// each following point moves it towards its value by the smoothing factor (i.e. average = average +
+// factor * (value - average)). NaN points are returned as is, and don't affect the average
+func exponentialMovingAverage(seriesList []*series, ema *emaTransform) []*series {
+	result := make([]*series, 0, len(seriesList))
+
+	for _, currentSeries := range seriesList {
+		points := make([]point, 0, len(currentSeries.points))
+
+		var average float64
+		var previous *point
+
+		for pointIdx := range currentSeries.points {
+			current := currentSeries.points[pointIdx]
+
+			if !math.IsNaN(current.v) {
+				if previous == nil {
+					average = current.v
+				} else {
+					average += ema.smoothingFactor(current.t-previous.t) * (current.v - average)
+				}
+
+				previous = &currentSeries.points[pointIdx]
+				current.v = average
+			}
+
+			points = append(points, current)
+		}
+
+		result = append(result, &series{labels: currentSeries.labels, points: points})
+	}
+
+	return result
+}
@@ -0,0 +1,68 @@
+// +build unit
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type emaSuite struct {
+	suite.Suite
+}
+
+func (suite *emaSuite) TestAlpha() {
+	ema := &emaTransform{Alpha: 0.5}
+	suite.Require().NoError(validateEMA(ema))
+
+	seriesList := []*series{{
+		labels: utils.LabelsFromStringList("__name__", "cpu"),
+		points: []point{{0, 10}, {1000, 20}, {2000, math.NaN()}, {3000, 0}, {4000, 40}},
+	}}
+
+	// starting at the first point, each point moves the average half the way towards it. the NaN is kept,
+	// and is skipped by the average
+	result := exponentialMovingAverage(seriesList, ema)
+	suite.Require().Len(result, 1)
+	suite.Require().Equal(seriesList[0].labels, result[0].labels)
+	suite.Require().Equal([]point{{0, 10}, {1000, 15}}, result[0].points[:2])
+	suite.Require().True(math.IsNaN(result[0].points[2].v))
+	suite.Require().Equal([]point{{3000, 7.5}, {4000, 23.75}}, result[0].points[3:])
+}
+
+func (suite *emaSuite) TestHalfLife() {
+	ema := &emaTransform{HalfLife: "1s"}
+	suite.Require().NoError(validateEMA(ema))
+
+	seriesList := []*series{{points: []point{{0, 0}, {1000, 8}, {3000, 12}}}}
+
+	// a point a half-life after the previous one moves the average half the way towards it, and one two
+	// half-lives after it three quarters of the way
+	result := exponentialMovingAverage(seriesList, ema)
+	suite.Require().Len(result[0].points, 3)
+	suite.Require().InDelta(0, result[0].points[0].v, 1e-9)
+	suite.Require().InDelta(4, result[0].points[1].v, 1e-9)
+	suite.Require().InDelta(10, result[0].points[2].v, 1e-9)
+}
+
+func (suite *emaSuite) TestValidation() {
+	suite.Require().NoError(validateEMA(nil))
+
+	for _, ema := range []*emaTransform{
+		{},
+		{Alpha: 0.5, HalfLife: "1m"},
+		{Alpha: 1.5},
+		{Alpha: -0.5},
+		{HalfLife: "1"},
+		{HalfLife: "1us"},
+	} {
+		suite.Require().Error(validateEMA(ema), "%+v", ema)
+	}
+}
+
+func TestEMASuite(t *testing.T) {
+	suite.Run(t, new(emaSuite))
+}
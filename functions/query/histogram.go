@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/v3io/v3io-tsdb/pkg/aggregate"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+// histograms are stored by the ingest function as a metric_bucket series per bucket, labeled by the
+// bucket's upper bound (le) and holding the cumulative count of observations up to it
+const (
+	histogramBucketSuffix = "_bucket"
+	histogramBucketLabel  = "le"
+	quantileLabel         = "quantile"
+)
+
+func validateQuantile(quantile *float64, aggregators []string, labels map[string]string) error {
+	if quantile == nil {
+		return nil
+	}
+
+	if *quantile < 0 || *quantile > 1 {
+		return errors.Errorf("Quantile must be between 0 and 1: %v", *quantile)
+	}
+
+	// the buckets are summed per step, which is the only aggregation that keeps them meaningful
+	if len(aggregators) != 0 {
+		return errors.New("Quantile can't be combined with aggregators")
+	}
+
+	// a histogram is made of several series, so it has no single label set to look up
+	if len(labels) != 0 {
+		return errors.New("Quantile can't be combined with labels - use a filter expression instead")
+	}
+
+	return nil
+}
+
+type bucket struct {
+	upperBound float64
+	count      float64
+}
+
+// histogramQuantile estimates a quantile of each histogram (bucket series sharing the same labels, other
+// than le) at each timestamp. like Prometheus, observations are assumed to be spread linearly within a
+// bucket, the lowest bucket starts at 0 (unless its bound is negative), and a quantile that falls in the
+// bucket above the largest bound is estimated as the largest bound
+func histogramQuantile(seriesList []*series, metricName string, quantile float64) []*series {
+	var result []*series
+	histograms := map[uint64]map[int64][]bucket{}
+	histogramLabels := map[uint64]utils.Labels{}
+
+	for _, bucketSeries := range seriesList {
+		upperBound, err := strconv.ParseFloat(bucketSeries.labels.Get(histogramBucketLabel), 64)
+		if err != nil {
+			continue
+		}
+
+		// identify the histogram by the labels of its series, other than the bucket and the aggregate
+		labels := utils.Labels{{Name: "__name__", Value: metricName}}
+		for _, label := range bucketSeries.labels {
+			switch label.Name {
+			case "__name__", histogramBucketLabel, aggregate.AggregateLabel:
+			default:
+				labels = append(labels, label)
+			}
+		}
+
+		hash := labels.Hash()
+		if _, found := histograms[hash]; !found {
+			histograms[hash] = map[int64][]bucket{}
+			histogramLabels[hash] = labels
+		}
+
+		for _, currentPoint := range bucketSeries.points {
+			histograms[hash][currentPoint.t] = append(histograms[hash][currentPoint.t], bucket{upperBound, currentPoint.v})
+		}
+	}
+
+	for hash, buckets := range histograms {
+		labels := append(histogramLabels[hash], utils.Label{
+			Name:  quantileLabel,
+			Value: strconv.FormatFloat(quantile, 'g', -1, 64),
+		})
+		sort.Sort(labels)
+
+		quantileSeries := &series{labels: labels}
+		for t, timestampBuckets := range buckets {
+			quantileSeries.points = append(quantileSeries.points, point{t, bucketQuantile(timestampBuckets, quantile)})
+		}
+
+		sort.Slice(quantileSeries.points, func(i, j int) bool {
+			return quantileSeries.points[i].t < quantileSeries.points[j].t
+		})
+
+		result = append(result, quantileSeries)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].labels.String() < result[j].labels.String() })
+
+	return result
+}
+
+// bucketQuantile estimates a quantile from the cumulative counts of a histogram's buckets
+func bucketQuantile(buckets []bucket, quantile float64) float64 {
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].upperBound < buckets[j].upperBound })
+
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].upperBound, 1) {
+		return math.NaN()
+	}
+
+	total := buckets[len(buckets)-1].count
+	if total == 0 {
+		return math.NaN()
+	}
+
+	rank := quantile * total
+	bucketIdx := sort.Search(len(buckets), func(i int) bool { return buckets[i].count >= rank })
+
+	// above the largest bound - there's no upper bound to interpolate to
+	if bucketIdx >= len(buckets)-1 {
+		return buckets[len(buckets)-2].upperBound
+	}
+
+	lowerBound, lowerCount := 0.0, 0.0
+	if bucketIdx > 0 {
+		lowerBound, lowerCount = buckets[bucketIdx-1].upperBound, buckets[bucketIdx-1].count
+	} else if buckets[0].upperBound <= 0 {
+		return buckets[0].upperBound
+	}
+
+	bucketCount := buckets[bucketIdx].count - lowerCount
+	if bucketCount == 0 {
+		return lowerBound
+	}
+
+	return lowerBound + (buckets[bucketIdx].upperBound-lowerBound)*(rank-lowerCount)/bucketCount
+}
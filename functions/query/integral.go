@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// the integral aggregator isn't supported by the TSDB, so it's computed here over the raw samples
+const integralAggregator = "integral"
+
+// hasIntegralAggregator checks whether the integral aggregator was requested. since it's computed over
+// raw samples, it can't be combined with aggregators computed by the TSDB
+func hasIntegralAggregator(aggregators []string) (bool, error) {
+	for _, aggregator := range aggregators {
+		if aggregator == integralAggregator {
+			if len(aggregators) != 1 {
+				return false, errors.New("The integral aggregator can't be combined with other aggregators")
+			}
+
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// integrate computes the area under each series (in value * seconds) per step-sized bucket of [from, to],
+// using trapezoidal integration between consecutive samples. each bucket is keyed by its start time. a
+// segment between two samples that crosses a bucket edge is split at the edge, its value there being
+// linearly interpolated, so each bucket only holds the area within it. the area is not extrapolated
+// before the first sample or after the last one - buckets that no segment covers (i.e. empty buckets
+// that aren't between two samples) are omitted. NaN samples are ignored. a step of 0 means a single bucket
+func integrate(seriesList []*series, from int64, to int64, step int64) []*series {
+	if step <= 0 {
+		step = to - from + 1
+	}
+
+	result := make([]*series, 0, len(seriesList))
+
+	for _, currentSeries := range seriesList {
+		result = append(result, &series{
+			labels: currentSeries.labels,
+			points: integrateSeries(currentSeries.points, from, to, step),
+		})
+	}
+
+	return result
+}
+
+func integrateSeries(points []point, from int64, to int64, step int64) []point {
+	var result []point
+	var previous *point
+
+	for pointIdx := range points {
+		current := &points[pointIdx]
+
+		if current.t < from || current.t > to || math.IsNaN(current.v) {
+			continue
+		}
+
+		if previous != nil {
+
+			// split the segment at bucket edges
+			for start := previous.t; start < current.t; {
+				bucket := from + (start-from)/step*step
+
+				end := bucket + step
+				if end > current.t {
+					end = current.t
+				}
+
+				area := (interpolate(previous, current, start) + interpolate(previous, current, end)) / 2 *
+					float64(end-start) / 1000
+
+				if len(result) != 0 && result[len(result)-1].t == bucket {
+					result[len(result)-1].v += area
+				} else {
+					result = append(result, point{t: bucket, v: area})
+				}
+
+				start = end
+			}
+		}
+
+		previous = current
+	}
+
+	return result
+}
+
+// interpolate returns the value at t on the line between two samples
+func interpolate(first *point, second *point, t int64) float64 {
+	return first.v + (second.v-first.v)*float64(t-first.t)/float64(second.t-first.t)
+}
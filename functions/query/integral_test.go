@@ -0,0 +1,52 @@
+// +build unit
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type integralSuite struct {
+	suite.Suite
+}
+
+func (suite *integralSuite) TestPiecewiseLinear() {
+
+	// f(t) rises from 0 to 10 over [0s, 10s], stays at 10 until 20s and falls back to 0 at 40s. its
+	// integral over [0s, 40s] is 50 + 100 + 100
+	points := []point{{0, 0}, {10000, 10}, {20000, 10}, {40000, 0}}
+
+	result := integrate([]*series{{points: points}}, 0, 40000, 0)
+	suite.Require().Equal([]point{{0, 250}}, result[0].points)
+
+	// per 15s bucket. [0s, 15s]: 50 + 50. [15s, 30s]: 50 + (10 + 5) / 2 * 10. [30s, 40s]: 5 * 10 / 2
+	result = integrate([]*series{{points: points}}, 0, 40000, 15000)
+	suite.Require().Equal([]point{{0, 100}, {15000, 125}, {30000, 25}}, result[0].points)
+}
+
+func (suite *integralSuite) TestNotExtrapolated() {
+	points := []point{{20000, 4}, {30000, 4}}
+
+	// the buckets before the first sample and after the last one are omitted
+	result := integrateSeries(points, 0, 59999, 10000)
+	suite.Require().Equal([]point{{20000, 40}}, result)
+}
+
+func (suite *integralSuite) TestCombinedAggregators() {
+	found, err := hasIntegralAggregator([]string{"integral"})
+	suite.Require().NoError(err)
+	suite.Require().True(found)
+
+	found, err = hasIntegralAggregator([]string{"avg"})
+	suite.Require().NoError(err)
+	suite.Require().False(found)
+
+	_, err = hasIntegralAggregator([]string{"integral", "avg"})
+	suite.Require().Error(err)
+}
+
+func TestIntegralSuite(t *testing.T) {
+	suite.Run(t, new(integralSuite))
+}
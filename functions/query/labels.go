@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+// Example label transform (keeps host and dc, then renames host to instance):
+//
+//	{
+//		"keep": ["host", "dc"],
+//		"rename": {"host": "instance"}
+//	}
+type labelTransform struct {
+	Rename map[string]string `json:"rename"`
+	Drop   []string          `json:"drop"`
+	Keep   []string          `json:"keep"`
+}
+
+func validateLabelTransform(transform *labelTransform) error {
+	if transform == nil {
+		return nil
+	}
+
+	if len(transform.Keep) != 0 && len(transform.Drop) != 0 {
+		return errors.New("Label transform can't both keep and drop labels")
+	}
+
+	keep := toSet(transform.Keep)
+	renamedTo := map[string]string{}
+
+	for labelName, newLabelName := range transform.Rename {
+		if labelName == "__name__" || newLabelName == "__name__" || newLabelName == "" {
+			return errors.Errorf("Invalid label rename: %s to %s", labelName, newLabelName)
+		}
+
+		if otherLabelName, found := renamedTo[newLabelName]; found {
+			return errors.Errorf("Labels %s and %s are both renamed to %s", otherLabelName, labelName, newLabelName)
+		}
+
+		renamedTo[newLabelName] = labelName
+
+		// a label that is kept (and not renamed itself) would be overwritten by the rename
+		if _, renamed := transform.Rename[newLabelName]; keep[newLabelName] && !renamed {
+			return errors.Errorf("Renaming %s to %s overwrites a kept label", labelName, newLabelName)
+		}
+	}
+
+	return nil
+}
+
+// transformLabels changes the labels of the series in the result only - the query (e.g. filtering and
+// grouping) is done over the stored labels. the metric name is always kept. series whose labels become
+// identical are not merged. renaming a label to the name of another label the series keeps fails, rather
+// than silently overwriting it
+func transformLabels(seriesList []*series, transform *labelTransform) ([]*series, error) {
+	keep := toSet(transform.Keep)
+	drop := toSet(transform.Drop)
+
+	for _, currentSeries := range seriesList {
+		labels := make(utils.Labels, 0, len(currentSeries.labels))
+		labelNames := make(map[string]bool, len(currentSeries.labels))
+
+		for _, label := range currentSeries.labels {
+			if label.Name != "__name__" {
+				if (len(keep) != 0 && !keep[label.Name]) || drop[label.Name] {
+					continue
+				}
+
+				if newLabelName, found := transform.Rename[label.Name]; found {
+					label.Name = newLabelName
+				}
+			}
+
+			if labelNames[label.Name] {
+				return nil, errors.Errorf("Label transform yields label %s twice for series %s",
+					label.Name,
+					currentSeries.labels.String())
+			}
+
+			labelNames[label.Name] = true
+			labels = append(labels, label)
+		}
+
+		sort.Sort(labels)
+		currentSeries.labels = labels
+	}
+
+	return seriesList, nil
+}
+
+func toSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+
+	return set
+}
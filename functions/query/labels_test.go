@@ -0,0 +1,76 @@
+// +build unit
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type labelsSuite struct {
+	suite.Suite
+}
+
+func (suite *labelsSuite) TestRenameAndKeep() {
+	seriesList := []*series{
+		{labels: utils.LabelsFromStringList("__name__", "cpu", "host", "a", "dc", "7", "rack", "r1")},
+	}
+
+	transform := &labelTransform{
+		Keep:   []string{"host", "dc"},
+		Rename: map[string]string{"host": "instance"},
+	}
+
+	suite.Require().NoError(validateLabelTransform(transform))
+
+	seriesList, err := transformLabels(seriesList, transform)
+	suite.Require().NoError(err)
+	suite.Require().Equal(utils.LabelsFromStringList("__name__", "cpu", "dc", "7", "instance", "a"), seriesList[0].labels)
+}
+
+func (suite *labelsSuite) TestDrop() {
+	seriesList := []*series{
+		{labels: utils.LabelsFromStringList("__name__", "cpu", "host", "a", "dc", "7")},
+	}
+
+	seriesList, err := transformLabels(seriesList, &labelTransform{Drop: []string{"dc", "__name__"}})
+	suite.Require().NoError(err)
+	suite.Require().Equal(utils.LabelsFromStringList("__name__", "cpu", "host", "a"), seriesList[0].labels)
+}
+
+func (suite *labelsSuite) TestRenameOverwritingKeptLabel() {
+	suite.Require().Error(validateLabelTransform(&labelTransform{
+		Keep:   []string{"host", "instance"},
+		Rename: map[string]string{"host": "instance"},
+	}))
+
+	suite.Require().Error(validateLabelTransform(&labelTransform{
+		Rename: map[string]string{"host": "instance", "node": "instance"},
+	}))
+
+	// swapping labels doesn't overwrite either of them
+	suite.Require().NoError(validateLabelTransform(&labelTransform{
+		Keep:   []string{"host", "instance"},
+		Rename: map[string]string{"host": "instance", "instance": "host"},
+	}))
+
+	// without keep, the overwritten label is only known per series
+	seriesList := []*series{
+		{labels: utils.LabelsFromStringList("__name__", "cpu", "host", "a", "instance", "b")},
+	}
+
+	_, err := transformLabels(seriesList, &labelTransform{Rename: map[string]string{"host": "instance"}})
+	suite.Require().Error(err)
+}
+
+func (suite *labelsSuite) TestInvalidTransform() {
+	suite.Require().Error(validateLabelTransform(&labelTransform{Keep: []string{"a"}, Drop: []string{"b"}}))
+	suite.Require().Error(validateLabelTransform(&labelTransform{Rename: map[string]string{"__name__": "name"}}))
+	suite.Require().Error(validateLabelTransform(&labelTransform{Rename: map[string]string{"host": ""}}))
+}
+
+func TestLabelsSuite(t *testing.T) {
+	suite.Run(t, new(labelsSuite))
+}
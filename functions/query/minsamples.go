@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/v3io/v3io-tsdb/pkg/aggregate"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+// the sample count of each bucket is queried along with the requested aggregators, to tell sparse buckets
+const countAggregator = "count"
+
+// validateMinSamplesPerBucket checks that a minimum sample count is only set for queries aggregated by
+// the TSDB into step-sized buckets (the extrapolated rate is computed over the raw samples)
+func validateMinSamplesPerBucket(minSamples int, aggregators []string, step string, extrapolateRate bool) error {
+	if minSamples == 0 {
+		return nil
+	}
+
+	if minSamples < 0 {
+		return errors.Errorf("Minimum samples per bucket must be positive: %d", minSamples)
+	}
+
+	if len(aggregators) == 0 || step == "" {
+		return errors.New("Minimum samples per bucket requires aggregators and a step")
+	}
+
+	if extrapolateRate {
+		return errors.New("Minimum samples per bucket can't be combined with rate extrapolation")
+	}
+
+	for _, aggregator := range aggregators {
+		if aggregator == integralAggregator {
+			return errors.New("Minimum samples per bucket can't be combined with the integral aggregator")
+		}
+	}
+
+	return nil
+}
+
+// withCountAggregator returns the aggregators along with count, unless it's already one of them
+func withCountAggregator(aggregators []string) []string {
+	for _, aggregator := range aggregators {
+		if aggregator == countAggregator {
+			return aggregators
+		}
+	}
+
+	return append(append([]string{}, aggregators...), countAggregator)
+}
+
+// dropSparseBuckets removes the buckets that aggregate less than minSamples samples from each aggregate
+// series, according to the count series of the same labels. the count series themselves are only returned
+// if the count aggregator was requested
+func dropSparseBuckets(seriesList []*series, minSamples int, countRequested bool) []*series {
+	counts := map[uint64]map[int64]float64{}
+
+	for _, currentSeries := range seriesList {
+		if currentSeries.labels.Get(aggregate.AggregateLabel) != countAggregator {
+			continue
+		}
+
+		bucketCounts := make(map[int64]float64, len(currentSeries.points))
+		for _, currentPoint := range currentSeries.points {
+			bucketCounts[currentPoint.t] = currentPoint.v
+		}
+
+		counts[withoutAggregateLabel(currentSeries.labels).Hash()] = bucketCounts
+	}
+
+	result := make([]*series, 0, len(seriesList))
+
+	for _, currentSeries := range seriesList {
+		if currentSeries.labels.Get(aggregate.AggregateLabel) == countAggregator && !countRequested {
+			continue
+		}
+
+		bucketCounts := counts[withoutAggregateLabel(currentSeries.labels).Hash()]
+
+		var points []point
+		for _, currentPoint := range currentSeries.points {
+			if bucketCounts[currentPoint.t] >= float64(minSamples) {
+				points = append(points, currentPoint)
+			}
+		}
+
+		result = append(result, &series{labels: currentSeries.labels, points: points})
+	}
+
+	return result
+}
+
+func withoutAggregateLabel(labels utils.Labels) utils.Labels {
+	result := make(utils.Labels, 0, len(labels))
+
+	for _, label := range labels {
+		if label.Name != aggregate.AggregateLabel {
+			result = append(result, label)
+		}
+	}
+
+	return result
+}
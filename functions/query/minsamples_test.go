@@ -0,0 +1,52 @@
+// +build unit
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/v3io/v3io-tsdb/pkg/aggregate"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type minSamplesSuite struct {
+	suite.Suite
+}
+
+func (suite *minSamplesSuite) TestValidate() {
+	suite.Require().NoError(validateMinSamplesPerBucket(0, nil, "", false))
+	suite.Require().NoError(validateMinSamplesPerBucket(3, []string{"avg"}, "1h", false))
+
+	suite.Require().Error(validateMinSamplesPerBucket(-1, []string{"avg"}, "1h", false))
+	suite.Require().Error(validateMinSamplesPerBucket(3, nil, "1h", false))
+	suite.Require().Error(validateMinSamplesPerBucket(3, []string{"avg"}, "", false))
+	suite.Require().Error(validateMinSamplesPerBucket(3, []string{integralAggregator}, "1h", false))
+
+	// the extrapolated rate is computed over the raw samples, which have no sample count
+	suite.Require().Error(validateMinSamplesPerBucket(3, []string{"rate"}, "1h", true))
+}
+
+func (suite *minSamplesSuite) TestDropSparseBuckets() {
+	avgSeries := &series{
+		labels: utils.LabelsFromStringList("__name__", "cpu", aggregate.AggregateLabel, "avg"),
+		points: []point{{t: 0, v: 1}, {t: 60000, v: 2}},
+	}
+	countSeries := &series{
+		labels: utils.LabelsFromStringList("__name__", "cpu", aggregate.AggregateLabel, countAggregator),
+		points: []point{{t: 0, v: 5}, {t: 60000, v: 2}},
+	}
+
+	result := dropSparseBuckets([]*series{avgSeries, countSeries}, 3, false)
+	suite.Require().Len(result, 1)
+	suite.Require().Equal([]point{{t: 0, v: 1}}, result[0].points)
+
+	// the count series is kept if it was requested
+	result = dropSparseBuckets([]*series{avgSeries, countSeries}, 3, true)
+	suite.Require().Len(result, 2)
+	suite.Require().Equal([]point{{t: 0, v: 5}}, result[1].points)
+}
+
+func TestMinSamplesSuite(t *testing.T) {
+	suite.Run(t, new(minSamplesSuite))
+}
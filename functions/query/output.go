@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/v3io/v3io-tsdb/pkg/chunkenc"
+	"github.com/v3io/v3io-tsdb/pkg/formatter"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+// output formats
+const (
+	outputFormatJSON    = "json"
+	outputFormatAligned = "aligned"
+	outputFormatNDJSON  = "ndjson"
+)
+
+/* Example aligned output:
+{
+	"timestamps": [1532095945000, 1532096005000],
+	"series": [
+		{"target": "cpu{host=a}", "values": [95.2, 86.8]},
+		{"target": "cpu{host=b}", "values": [null, 12.4]}
+	]
+}
+*/
+type alignedSeries struct {
+	Target string     `json:"target"`
+	Values []*float64 `json:"values"`
+}
+
+type alignedOutput struct {
+	Timestamps []int64         `json:"timestamps"`
+	Series     []alignedSeries `json:"series"`
+}
+
+/* Example ndjson output (one line per series, datapoints are [value, time] like in json):
+{"target": "cpu{host=a}", "labels": {"__name__": "cpu", "host": "a"}, "datapoints": [[95.2, 1532095945000]]}
+{"target": "cpu{host=b}", "labels": {"__name__": "cpu", "host": "b"}, "datapoints": [[null, 1532095945000]]}
+*/
+type ndjsonSeries struct {
+	Target     string            `json:"target"`
+	Labels     map[string]string `json:"labels"`
+	Datapoints [][2]interface{}  `json:"datapoints"`
+}
+
+// the parameters of a query as resolved by the function (e.g. relative times, coarsened steps and the
+// aggregators that were actually used to compute the result)
+type effectiveParameters struct {
+	Start       int64  `json:"start"`
+	End         int64  `json:"end"`
+	Step        int64  `json:"step"`
+	Aggregators string `json:"aggregators,omitempty"`
+
+	// whether the result was computed from raw samples
+	Raw bool `json:"raw"`
+}
+
+/* Example json / aligned output with effective parameters:
+{
+	"effective": {"start": 1532095945000, "end": 1532099545000, "step": 60000, "aggregators": "avg", "raw": false},
+	"result": [...]
+}
+
+ndjson output holds the effective parameters in its first line, as {"effective": {...}}
+*/
+type outputWithEffective struct {
+	Effective *effectiveParameters `json:"effective"`
+	Result    json.RawMessage      `json:"result,omitempty"`
+}
+
+func validateOutputFormat(outputFormat string) error {
+	switch outputFormat {
+	case "", outputFormatJSON, outputFormatAligned, outputFormatNDJSON:
+		return nil
+	default:
+		return errors.Errorf("Unknown output format: %s", outputFormat)
+	}
+}
+
+func writeOutput(out io.Writer, outputFormat string, seriesSet utils.SeriesSet) error {
+	switch outputFormat {
+	case "", outputFormatJSON:
+
+		// convert SeriesSet to JSON (Grafana simpleJson format)
+		jsonFormatter, err := formatter.NewFormatter("json", nil)
+		if err != nil {
+			return errors.Wrap(err, "failed to start json formatter")
+		}
+
+		return jsonFormatter.Write(out, seriesSet)
+	case outputFormatAligned:
+		return writeAligned(out, seriesSet)
+	case outputFormatNDJSON:
+		return writeNDJSON(out, seriesSet)
+	default:
+		return errors.Errorf("Unknown output format: %s", outputFormat)
+	}
+}
+
+// writeAligned writes all series over a single shared timestamp axis, so the result is a rectangular
+// matrix. a series with no sample at a given timestamp holds null there
+func writeAligned(out io.Writer, seriesSet utils.SeriesSet) error {
+	seriesList, err := readSeries(seriesSet)
+	if err != nil {
+		return err
+	}
+
+	output := alignedOutput{
+		Timestamps: timestamps(seriesList),
+		Series:     make([]alignedSeries, 0, len(seriesList)),
+	}
+
+	// map each timestamp to its index on the shared axis
+	timestampIndex := make(map[int64]int, len(output.Timestamps))
+	for index, t := range output.Timestamps {
+		timestampIndex[t] = index
+	}
+
+	for _, currentSeries := range seriesList {
+		values := make([]*float64, len(output.Timestamps))
+
+		for pointIdx := range currentSeries.points {
+			currentPoint := &currentSeries.points[pointIdx]
+
+			// json has no representation for NaN / Inf - leave these as null
+			if math.IsNaN(currentPoint.v) || math.IsInf(currentPoint.v, 0) {
+				continue
+			}
+
+			values[timestampIndex[currentPoint.t]] = &currentPoint.v
+		}
+
+		output.Series = append(output.Series, alignedSeries{
+			Target: currentSeries.target(),
+			Values: values,
+		})
+	}
+
+	return json.NewEncoder(out).Encode(&output)
+}
+
+// writeNDJSON writes each series as a separate line holding a json object, as the series are read (so only
+// their encoding is held in memory). nuclio responds with the whole body, so the lines are only streamed to
+// the client once all the series were written, and clients can then parse them one at a time
+func writeNDJSON(out io.Writer, seriesSet utils.SeriesSet) error {
+	encoder := json.NewEncoder(out)
+
+	for seriesSet.Next() {
+		iter := seriesSet.At().Iterator()
+		if iter.Encoding() != chunkenc.EncXOR {
+			continue
+		}
+
+		currentSeries := &series{labels: seriesSet.At().Labels()}
+		output := ndjsonSeries{
+			Target:     currentSeries.target(),
+			Labels:     map[string]string{},
+			Datapoints: [][2]interface{}{},
+		}
+
+		for _, label := range currentSeries.labels {
+			output.Labels[label.Name] = label.Value
+		}
+
+		for iter.Next() {
+			t, v := iter.At()
+
+			// json has no representation for NaN / Inf - write these as null
+			var value interface{}
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				value = v
+			}
+
+			output.Datapoints = append(output.Datapoints, [2]interface{}{value, t})
+		}
+
+		if iter.Err() != nil {
+			return iter.Err()
+		}
+
+		// the encoder terminates each object with a newline
+		if err := encoder.Encode(&output); err != nil {
+			return err
+		}
+	}
+
+	return seriesSet.Err()
+}
+
+// withEffective adds the effective parameters of the query to its output
+func withEffective(output *bytes.Buffer, outputFormat string, effective *effectiveParameters) error {
+	result := output.Bytes()
+
+	if outputFormat == outputFormatNDJSON {
+		effectiveLine, err := json.Marshal(&outputWithEffective{Effective: effective})
+		if err != nil {
+			return err
+		}
+
+		// the result holds the written lines, which follow the effective parameters
+		result = append(append(effectiveLine, '\n'), result...)
+	} else {
+		var err error
+
+		result, err = json.Marshal(&outputWithEffective{Effective: effective, Result: result})
+		if err != nil {
+			return err
+		}
+	}
+
+	output.Reset()
+	output.Write(result)
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// +build unit
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type outputSuite struct {
+	suite.Suite
+}
+
+func (suite *outputSuite) TestAligned() {
+
+	// a dense series and a sparse one, whose timestamps only partly overlap
+	seriesList := []*series{
+		{
+			labels: utils.LabelsFromStringList("__name__", "cpu", "host", "a"),
+			points: []point{{1000, 1}, {2000, 2}, {3000, 3}, {4000, math.NaN()}},
+		},
+		{
+			labels: utils.LabelsFromStringList("__name__", "cpu", "host", "b"),
+			points: []point{{2000, 20}, {5000, 50}},
+		},
+	}
+
+	var buffer bytes.Buffer
+	suite.Require().NoError(writeOutput(&buffer, outputFormatAligned, newSeriesSet(seriesList)))
+
+	var output alignedOutput
+	suite.Require().NoError(json.Unmarshal(buffer.Bytes(), &output))
+
+	suite.Require().Equal([]int64{1000, 2000, 3000, 4000, 5000}, output.Timestamps)
+	suite.Require().Len(output.Series, 2)
+
+	suite.Require().Equal("cpu{host=a}", output.Series[0].Target)
+	suite.Require().Equal([]*float64{float64Ptr(1), float64Ptr(2), float64Ptr(3), nil, nil}, output.Series[0].Values)
+
+	suite.Require().Equal("cpu{host=b}", output.Series[1].Target)
+	suite.Require().Equal([]*float64{nil, float64Ptr(20), nil, nil, float64Ptr(50)}, output.Series[1].Values)
+}
+
+func (suite *outputSuite) TestNDJSON() {
+	seriesList := []*series{
+		{
+			labels: utils.LabelsFromStringList("__name__", "cpu", "host", "a"),
+			points: []point{{1000, 1}, {2000, math.Inf(1)}},
+		},
+		{
+			labels: utils.LabelsFromStringList("__name__", "cpu", "host", "b"),
+			points: []point{{2000, 20}},
+		},
+	}
+
+	var buffer bytes.Buffer
+	suite.Require().NoError(writeOutput(&buffer, outputFormatNDJSON, newSeriesSet(seriesList)))
+	suite.Require().NoError(withEffective(&buffer, outputFormatNDJSON, &effectiveParameters{Start: 1000, End: 2000}))
+
+	// the effective parameters are followed by a line per series
+	lines := bytes.Split(bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), []byte("\n"))
+	suite.Require().Len(lines, 3)
+
+	var effectiveLine outputWithEffective
+	suite.Require().NoError(json.Unmarshal(lines[0], &effectiveLine))
+	suite.Require().Equal(int64(2000), effectiveLine.Effective.End)
+
+	suite.Require().JSONEq(`{"target": "cpu{host=a}", "labels": {"__name__": "cpu", "host": "a"}, "datapoints": [[1, 1000], [null, 2000]]}`,
+		string(lines[1]))
+	suite.Require().JSONEq(`{"target": "cpu{host=b}", "labels": {"__name__": "cpu", "host": "b"}, "datapoints": [[20, 2000]]}`,
+		string(lines[2]))
+}
+
+func (suite *outputSuite) TestUnknownFormat() {
+	suite.Require().Error(validateOutputFormat("csv"))
+	suite.Require().Error(writeOutput(&bytes.Buffer{}, "csv", newSeriesSet(nil)))
+}
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
+
+func TestOutputSuite(t *testing.T) {
+	suite.Run(t, new(outputSuite))
+}
@@ -2,42 +2,66 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/nuclio/nuclio-sdk-go"
 	"github.com/pkg/errors"
 	"github.com/v3io/v3io-tsdb/pkg/config"
-	"github.com/v3io/v3io-tsdb/pkg/formatter"
 	"github.com/v3io/v3io-tsdb/pkg/pquerier"
 	"github.com/v3io/v3io-tsdb/pkg/tsdb"
 	"github.com/v3io/v3io-tsdb/pkg/utils"
 )
 
-/* Example request:
-{
-	"metric": "cpu",
-	"step": "1m",
-	"start_time": "1532095945142",
-	"end_time": "1642995948517"
-}
+/*
+	Example request:
+
+	{
+		"metric": "cpu",
+		"step": "1m",
+		"start_time": "1532095945142",
+		"end_time": "1642995948517",
+		"output_format": "aligned",
+		"labels": {"host": "a"}
+	}
 */
 type request struct {
-	Metric           string   `json:"metric"`
-	Aggregators      []string `json:"aggregators"`
-	FilterExpression string   `json:"filter_expression"`
-	Step             string   `json:"step"`
-	StartTime        string   `json:"start_time"`
-	EndTime          string   `json:"end_time"`
-	Last             string   `json:"last"`
+	Metric           string            `json:"metric"`
+	Aggregators      []string          `json:"aggregators"`
+	FilterExpression string            `json:"filter_expression"`
+	Step             string            `json:"step"`
+	StartTime        string            `json:"start_time"`
+	EndTime          string            `json:"end_time"`
+	Last             string            `json:"last"`
+	OutputFormat     string            `json:"output_format"`
+	Labels           map[string]string `json:"labels"`
+	CoarsenStep      bool              `json:"coarsen_step"`
+	Quantile         *float64          `json:"quantile"`
+	LabelTransform   *labelTransform   `json:"label_transform"`
+	IncludeEffective bool              `json:"include_effective"`
+	ExtrapolateRate  bool              `json:"extrapolate_rate"`
+	MinSamples       int               `json:"min_samples_per_bucket"`
+	EMA              *emaTransform     `json:"ema"`
+	Timeout          string            `json:"timeout"`
 }
 
 var adapter *tsdb.V3ioAdapter
 var adapterLock sync.Mutex
 
+// nil, unless enabled by configuration
+var queryCache *resultCache
+
+// the maximum number of steps (i.e. points per series) a query may span. 0 means unlimited
+var maxPoints int64
+
+// the clock against which relative query times are resolved and cached results expire
+var clock = time.Now
+
 func Query(context *nuclio.Context, event nuclio.Event) (interface{}, error) {
 	request := request{}
 
@@ -48,26 +72,64 @@ func Query(context *nuclio.Context, event nuclio.Event) (interface{}, error) {
 
 	context.Logger.DebugWith("Got query request", "request", request)
 
-	// convert string times (unix or RFC3339 or relative like now-2h) to unix milisec times
-	from, to, step, err := utils.GetTimeFromRange(request.StartTime, request.EndTime, request.Last, request.Step)
+	if err := validateOutputFormat(request.OutputFormat); err != nil {
+		return nil, nuclio.WrapErrBadRequest(err)
+	}
+
+	integral, err := hasIntegralAggregator(request.Aggregators)
+	if err != nil {
+		return nil, nuclio.WrapErrBadRequest(err)
+	}
+
+	if err := validateRateExtrapolation(request.ExtrapolateRate, request.Aggregators); err != nil {
+		return nil, nuclio.WrapErrBadRequest(err)
+	}
+
+	if err := validateMinSamplesPerBucket(request.MinSamples, request.Aggregators, request.Step, request.ExtrapolateRate); err != nil {
+		return nil, nuclio.WrapErrBadRequest(err)
+	}
+
+	if err := validateEMA(request.EMA); err != nil {
+		return nil, nuclio.WrapErrBadRequest(err)
+	}
+
+	if err := validateLabelTransform(request.LabelTransform); err != nil {
+		return nil, nuclio.WrapErrBadRequest(err)
+	}
+
+	if err := validateQuantile(request.Quantile, request.Aggregators, request.Labels); err != nil {
+		return nil, nuclio.WrapErrBadRequest(err)
+	}
+
+	invocationContext, cancel, err := newInvocationContext(request.Timeout)
+	if err != nil {
+		return nil, nuclio.WrapErrBadRequest(err)
+	}
+
+	defer cancel()
+
+	from, to, step, err := resolveTimeRange(&request)
 	if err != nil {
-		return nil, nuclio.WrapErrBadRequest(errors.Wrap(err, "Error parsing query time range"))
+		return nil, nuclio.WrapErrBadRequest(err)
+	}
+
+	var cacheKey string
+	if queryCache != nil {
+		from, to = alignToStep(from, to, step)
+		cacheKey = getCacheKey(&request, from, to, step)
+
+		if result, found := queryCache.get(cacheKey); found {
+			return result, nil
+		}
 	}
 
 	// Create TSDB Querier
-	querier, err := adapter.QuerierV2()
+	querier, err := adapter.QuerierV2WithContext(invocationContext)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to initialize querier")
 	}
 
-	params := &pquerier.SelectParams{
-		Name:      request.Metric,
-		Functions: strings.Join(request.Aggregators, ","),
-		Step:      step,
-		Filter:    request.FilterExpression,
-		From:      from,
-		To:        to,
-	}
+	params := getSelectParams(&request, integral, from, to, step)
 
 	// Select query to get back a series set iterator
 	seriesSet, err := querier.Select(params)
@@ -75,16 +137,82 @@ func Query(context *nuclio.Context, event nuclio.Event) (interface{}, error) {
 		return nil, errors.Wrap(err, "Failed to execute query select")
 	}
 
-	// convert SeriesSet to JSON (Grafana simpleJson format)
-	jsonFormatter, err := formatter.NewFormatter("json", nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to start json formatter")
+	if integral {
+		seriesList, err := readSeries(seriesSet)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read series")
+		}
+
+		seriesSet = newSeriesSet(integrate(seriesList, from, to, step))
+	}
+
+	if request.ExtrapolateRate {
+		seriesList, err := readSeries(seriesSet)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read series")
+		}
+
+		seriesSet = newSeriesSet(extrapolatedRate(seriesList, from, to, step))
+	}
+
+	if request.MinSamples != 0 {
+		seriesList, err := readSeries(seriesSet)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read series")
+		}
+
+		countRequested := len(withCountAggregator(request.Aggregators)) == len(request.Aggregators)
+		seriesSet = newSeriesSet(dropSparseBuckets(seriesList, request.MinSamples, countRequested))
+	}
+
+	if request.Quantile != nil {
+		seriesList, err := readSeries(seriesSet)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read series")
+		}
+
+		seriesSet = newSeriesSet(histogramQuantile(seriesList, request.Metric, *request.Quantile))
+	}
+
+	if request.EMA != nil {
+		seriesList, err := readSeries(seriesSet)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read series")
+		}
+
+		seriesSet = newSeriesSet(exponentialMovingAverage(seriesList, request.EMA))
+	}
+
+	if request.LabelTransform != nil {
+		seriesList, err := readSeries(seriesSet)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read series")
+		}
+
+		seriesList, err = transformLabels(seriesList, request.LabelTransform)
+		if err != nil {
+			return nil, err
+		}
+
+		seriesSet = newSeriesSet(seriesList)
 	}
 
 	var buffer bytes.Buffer
-	err = jsonFormatter.Write(&buffer, seriesSet)
+	if err := writeOutput(&buffer, request.OutputFormat, seriesSet); err != nil {
+		return nil, err
+	}
 
-	return buffer.String(), err
+	if request.IncludeEffective {
+		if err := withEffective(&buffer, request.OutputFormat, getEffectiveParameters(params, step)); err != nil {
+			return nil, err
+		}
+	}
+
+	if queryCache != nil && queryCache.isCacheable(to, step) {
+		queryCache.set(cacheKey, buffer.String())
+	}
+
+	return buffer.String(), nil
 }
 
 // InitContext runs only once when the function runtime starts
@@ -98,10 +226,57 @@ func InitContext(context *nuclio.Context) error {
 
 	context.Logger.InfoWith("Initializing", "v3ioAdapterPath", v3ioAdapterPath)
 
+	if err := createQueryCache(context); err != nil {
+		return err
+	}
+
+	maxPointsPerSeries, err := toNumber(os.Getenv("QUERY_MAX_POINTS"), 0)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get maximum number of points")
+	}
+
+	maxPoints = int64(maxPointsPerSeries)
+
 	// create v3io adapter
 	return createV3ioAdapter(context, v3ioAdapterPath)
 }
 
+func createQueryCache(context *nuclio.Context) error {
+	adapterLock.Lock()
+	defer adapterLock.Unlock()
+
+	// caching is disabled unless a ttl is set
+	cacheTTL := os.Getenv("QUERY_CACHE_TTL")
+	if cacheTTL == "" || queryCache != nil {
+		return nil
+	}
+
+	ttl, err := time.ParseDuration(cacheTTL)
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse cache TTL")
+	}
+
+	maxEntries, err := toNumber(os.Getenv("QUERY_CACHE_SIZE"), 100)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get cache size")
+	}
+
+	if maxEntries < 0 {
+		return errors.Errorf("Invalid cache size: %d", maxEntries)
+	}
+
+	// a size of 0 disables caching too
+	if maxEntries == 0 {
+		return nil
+	}
+
+	context.Logger.InfoWith("Creating query cache", "ttl", ttl, "maxEntries", maxEntries)
+
+	queryCache = newResultCache(ttl, maxEntries, clock)
+
+	return nil
+}
+
 func createV3ioAdapter(context *nuclio.Context, path string) error {
 	context.Logger.InfoWith("Creating v3io adapter", "path", path)
 
@@ -146,6 +321,123 @@ func createV3ioAdapter(context *nuclio.Context, path string) error {
 	return nil
 }
 
+// newInvocationContext returns the context that the backend requests of an invocation are bound to. nuclio
+// doesn't pass the invocation's deadline to the function, so it's the query's timeout (if set), after which
+// the requests are abandoned rather than outliving the invocation. without a timeout nothing can cancel the
+// requests, so they're bound to the background context, which sends them directly
+func newInvocationContext(timeout string) (context.Context, context.CancelFunc, error) {
+	if timeout == "" {
+		return context.Background(), func() {}, nil
+	}
+
+	duration, err := time.ParseDuration(timeout)
+	if err != nil || duration <= 0 {
+		return nil, nil, errors.Errorf("Invalid timeout: %s", timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	return ctx, cancel, nil
+}
+
+// resolveTimeRange converts the string times of the request (unix or RFC3339 or relative like now-2h) to unix
+// milisec times, and limits its step
+func resolveTimeRange(request *request) (int64, int64, int64, error) {
+	from, to, step, err := utils.GetTimeFromRangeAt(clock(), request.StartTime, request.EndTime, request.Last, request.Step)
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, "Error parsing query time range")
+	}
+
+	step, err = limitStep(from, to, step, request.CoarsenStep)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return from, to, step, nil
+}
+
+// getSelectParams returns the parameters of the select that reads what the request's result is computed from
+func getSelectParams(request *request, integral bool, from int64, to int64, step int64) *pquerier.SelectParams {
+	params := &pquerier.SelectParams{
+		Name:      request.Metric,
+		Functions: strings.Join(request.Aggregators, ","),
+		Step:      step,
+		Filter:    request.FilterExpression,
+		From:      from,
+		To:        to,
+	}
+
+	// the integral and the extrapolated rate are computed over the raw samples
+	if integral || request.ExtrapolateRate {
+		params.Functions = ""
+		params.Step = 0
+	}
+
+	// sparse buckets are told by their sample count
+	if request.MinSamples != 0 {
+		params.Functions = strings.Join(withCountAggregator(request.Aggregators), ",")
+	}
+
+	// a quantile is estimated from the histogram's buckets, summed per step
+	if request.Quantile != nil {
+		params.Name = request.Metric + histogramBucketSuffix
+		if step != 0 {
+			params.Functions = "sum"
+		}
+	}
+
+	// when the complete label set of a series is known, read it directly rather than scanning the metric
+	if len(request.Labels) != 0 {
+		params.LabelSet = getLabelSet(request.Metric, request.Labels)
+	}
+
+	return params
+}
+
+// getEffectiveParameters returns the parameters the query was resolved to
+func getEffectiveParameters(params *pquerier.SelectParams, step int64) *effectiveParameters {
+	return &effectiveParameters{
+		Start:       params.From,
+		End:         params.To,
+		Step:        step,
+		Aggregators: params.Functions,
+		Raw:         params.Step == 0,
+	}
+}
+
+// limitStep guards against steps that are too small for the range (e.g. 1s over 90 days), which would
+// produce more points than the function can hold. such steps are rejected, unless coarsening was requested,
+// in which case the step is increased to the smallest whole number of seconds that fits. raw queries (no
+// step) are not limited
+func limitStep(from int64, to int64, step int64, coarsen bool) (int64, error) {
+	if maxPoints == 0 || step == 0 || (to-from)/step <= maxPoints {
+		return step, nil
+	}
+
+	// the smallest step (rounded up to whole seconds) for which the range spans at most maxPoints steps
+	minStep := (to - from + maxPoints - 1) / maxPoints
+	minStep = (minStep + 999) / 1000 * 1000
+
+	if coarsen {
+		return minStep, nil
+	}
+
+	return 0, errors.Errorf("A step of %dms over this range produces %d points per series, more than the maximum of %d. "+
+		"Use a step of at least %dm, or set coarsen_step to have it increased automatically",
+		step, (to-from)/step, maxPoints, (minStep+utils.OneMinuteMs-1)/utils.OneMinuteMs)
+}
+
+// convert the metric name and labels of a series to its (sorted) label set
+func getLabelSet(metricName string, labels map[string]string) utils.Labels {
+	labelsWithName := make(map[string]string, len(labels)+1)
+	for labelName, labelValue := range labels {
+		labelsWithName[labelName] = labelValue
+	}
+
+	labelsWithName["__name__"] = metricName
+
+	return utils.LabelsFromMap(labelsWithName)
+}
+
 func toNumber(input string, defaultValue int) (int, error) {
 	if input == "" {
 		return defaultValue, nil
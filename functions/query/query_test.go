@@ -0,0 +1,125 @@
+// +build unit
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type querySuite struct {
+	suite.Suite
+}
+
+func (suite *querySuite) TestInvocationContext() {
+	ctx, cancel, err := newInvocationContext("")
+	suite.Require().NoError(err)
+
+	_, hasDeadline := ctx.Deadline()
+	suite.Require().False(hasDeadline)
+
+	// a context that can't be canceled, so that requests bound to it are sent directly
+	suite.Require().Nil(ctx.Done())
+	cancel()
+	suite.Require().NoError(ctx.Err())
+
+	ctx, cancel, err = newInvocationContext("10s")
+	suite.Require().NoError(err)
+	defer cancel()
+
+	deadline, hasDeadline := ctx.Deadline()
+	suite.Require().True(hasDeadline)
+	suite.Require().WithinDuration(time.Now().Add(10*time.Second), deadline, time.Second)
+}
+
+func (suite *querySuite) TestInvalidTimeout() {
+	for _, timeout := range []string{"10", "-1s", "0s"} {
+		_, _, err := newInvocationContext(timeout)
+		suite.Require().Error(err, timeout)
+	}
+}
+
+func (suite *querySuite) TestLimitStep() {
+	defer func(previousMaxPoints int64) { maxPoints = previousMaxPoints }(maxPoints)
+	maxPoints = 1000
+
+	day := int64(24 * time.Hour / time.Millisecond)
+
+	// a minute step over a day spans 1440 points, more than the maximum
+	_, err := limitStep(0, day, 60000, false)
+	suite.Require().Error(err)
+	suite.Require().Contains(err.Error(), "at least 2m")
+
+	// the step is increased to the smallest whole number of seconds that fits
+	step, err := limitStep(0, day, 60000, true)
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(87000), step)
+	suite.Require().True(day/step <= maxPoints)
+
+	// steps that fit, raw queries and unlimited points are left as is
+	step, err = limitStep(0, day, 3600000, false)
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(3600000), step)
+
+	step, err = limitStep(0, day, 0, false)
+	suite.Require().NoError(err)
+	suite.Require().Zero(step)
+
+	maxPoints = 0
+	step, err = limitStep(0, day, 1000, false)
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(1000), step)
+}
+
+func (suite *querySuite) TestEffectiveParameters() {
+	defer func(previousMaxPoints int64, previousClock func() time.Time) {
+		maxPoints, clock = previousMaxPoints, previousClock
+	}(maxPoints, clock)
+
+	now := time.Unix(1532099545, 0)
+	clock = func() time.Time { return now }
+	maxPoints = 1000
+
+	// a relative range, whose step is coarsened to fit
+	request := request{
+		StartTime:   "now-1d",
+		EndTime:     "now",
+		Step:        "1m",
+		CoarsenStep: true,
+		Aggregators: []string{"avg", "max"},
+	}
+
+	from, to, step, err := resolveTimeRange(&request)
+	suite.Require().NoError(err)
+
+	buffer := bytes.NewBufferString("[]")
+	effective := getEffectiveParameters(getSelectParams(&request, false, from, to, step), step)
+	suite.Require().NoError(withEffective(buffer, outputFormatJSON, effective))
+
+	var output outputWithEffective
+	suite.Require().NoError(json.Unmarshal(buffer.Bytes(), &output))
+
+	// the echoed parameters are the ones the query was resolved to
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	suite.Require().Equal(&effectiveParameters{
+		Start:       nowMs - 24*3600*1000,
+		End:         nowMs,
+		Step:        87000,
+		Aggregators: "avg,max",
+	}, output.Effective)
+	suite.Require().Equal("[]", string(output.Result))
+
+	// the integral is computed from raw samples
+	effective = getEffectiveParameters(getSelectParams(&request, true, from, to, step), step)
+	suite.Require().True(effective.Raw)
+	suite.Require().Empty(effective.Aggregators)
+	suite.Require().Equal(int64(87000), effective.Step)
+}
+
+func TestQuerySuite(t *testing.T) {
+	suite.Run(t, new(querySuite))
+}
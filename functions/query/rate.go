@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const rateAggregator = "rate"
+
+// validateRateExtrapolation checks that an extrapolated rate was requested as the only aggregator. since
+// it's computed over raw samples, it can't be combined with aggregators computed by the TSDB
+func validateRateExtrapolation(extrapolate bool, aggregators []string) error {
+	if !extrapolate {
+		return nil
+	}
+
+	if len(aggregators) != 1 || aggregators[0] != rateAggregator {
+		return errors.New("Rate extrapolation requires rate to be the only aggregator")
+	}
+
+	return nil
+}
+
+// extrapolatedRate computes the per-second rate of increase of each counter series per step-sized bucket of
+// [from, to], keyed by the bucket start. the increase is computed from the samples within the bucket, like
+// the TSDB's rate, but since the first and last samples rarely fall on the bucket edges, the increase is
+// extrapolated towards the edges to cover the whole bucket (as Prometheus does). it's extrapolated all the
+// way to an edge if the gap to it is shorter than 1.1 times the average interval between the samples, and
+// by half an average interval otherwise (assuming the series starts or ends there). a counter isn't
+// extrapolated below zero before its first sample. counter resets (i.e. decreasing values) are compensated
+// for. buckets with less than two samples, or whose samples all share a timestamp, are omitted. NaN samples
+// are ignored. a step of 0 means a single bucket
+func extrapolatedRate(seriesList []*series, from int64, to int64, step int64) []*series {
+	if step <= 0 {
+		step = to - from + 1
+	}
+
+	result := make([]*series, 0, len(seriesList))
+
+	for _, currentSeries := range seriesList {
+		result = append(result, &series{
+			labels: currentSeries.labels,
+			points: extrapolatedRateSeries(currentSeries.points, from, to, step),
+		})
+	}
+
+	return result
+}
+
+func extrapolatedRateSeries(points []point, from int64, to int64, step int64) []point {
+	var result []point
+	var bucketPoints []point
+
+	for pointIdx, current := range points {
+		if current.t >= from && current.t <= to && !math.IsNaN(current.v) {
+			bucketPoints = append(bucketPoints, current)
+		}
+
+		// emit the bucket once its last sample was seen
+		if len(bucketPoints) != 0 {
+			bucket := from + (bucketPoints[0].t-from)/step*step
+
+			if pointIdx == len(points)-1 || points[pointIdx+1].t >= bucket+step {
+				if bucketPoints[len(bucketPoints)-1].t > bucketPoints[0].t {
+					result = append(result, point{
+						t: bucket,
+						v: bucketRate(bucketPoints, bucket, bucket+step),
+					})
+				}
+
+				bucketPoints = bucketPoints[:0]
+			}
+		}
+	}
+
+	return result
+}
+
+// bucketRate computes the extrapolated per-second rate of the samples of the bucket [start, end)
+func bucketRate(points []point, start int64, end int64) float64 {
+	first := points[0]
+	last := points[len(points)-1]
+
+	// compensate for counter resets
+	increase := last.v - first.v
+	for pointIdx := 1; pointIdx < len(points); pointIdx++ {
+		if points[pointIdx].v < points[pointIdx-1].v {
+			increase += points[pointIdx-1].v
+		}
+	}
+
+	sampledInterval := float64(last.t-first.t) / 1000
+	averageInterval := sampledInterval / float64(len(points)-1)
+	extrapolationThreshold := averageInterval * 1.1
+
+	durationToStart := float64(first.t-start) / 1000
+	durationToEnd := float64(end-last.t) / 1000
+
+	// the counter was (at most) zero when it was created
+	if increase > 0 && first.v >= 0 {
+		durationToZero := sampledInterval * first.v / increase
+		if durationToZero < durationToStart {
+			durationToStart = durationToZero
+		}
+	}
+
+	extrapolatedInterval := sampledInterval
+
+	if durationToStart < extrapolationThreshold {
+		extrapolatedInterval += durationToStart
+	} else {
+		extrapolatedInterval += averageInterval / 2
+	}
+
+	if durationToEnd < extrapolationThreshold {
+		extrapolatedInterval += durationToEnd
+	} else {
+		extrapolatedInterval += averageInterval / 2
+	}
+
+	return increase * extrapolatedInterval / sampledInterval / (float64(end-start) / 1000)
+}
@@ -0,0 +1,59 @@
+// +build unit
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type rateSuite struct {
+	suite.Suite
+}
+
+func (suite *rateSuite) TestEdgeBuckets() {
+
+	// a counter increasing by 1 per second, sampled every 10 seconds. the second bucket has no samples
+	// during its last 35 seconds
+	points := []point{
+		{5000, 5}, {15000, 15}, {25000, 25}, {35000, 35}, {45000, 45}, {55000, 55},
+		{65000, 65}, {75000, 75}, {85000, 85},
+	}
+
+	rates := extrapolatedRateSeries(points, 0, 119999, 60000)
+
+	// without extrapolation both buckets have a rate of 1. the first bucket is extrapolated all the way to
+	// its edges, so its rate stays 1. the second one is extrapolated by only half an interval towards its
+	// end, assuming the series ended there
+	suite.Require().Equal([]point{{0, 1}, {60000, 0.5}}, rates)
+}
+
+func (suite *rateSuite) TestCounterReset() {
+	points := []point{{0, 10}, {10000, 20}, {20000, 5}, {30000, 15}}
+
+	rates := extrapolatedRateSeries(points, 0, 39999, 40000)
+
+	// an increase of 25 (5 after the reset, plus the 20 before it), extrapolated from the 30 seconds
+	// sampled to the 40 seconds of the bucket
+	suite.Require().Len(rates, 1)
+	suite.Require().InDelta(25.0/30, rates[0].v, 1e-9)
+}
+
+func (suite *rateSuite) TestSkippedBuckets() {
+
+	// a single sample, and two samples sharing a timestamp
+	points := []point{{5000, 1}, {65000, 2}, {65000, 3}}
+
+	suite.Require().Empty(extrapolatedRateSeries(points, 0, 119999, 60000))
+}
+
+func (suite *rateSuite) TestValidation() {
+	suite.Require().NoError(validateRateExtrapolation(false, []string{"avg", "max"}))
+	suite.Require().NoError(validateRateExtrapolation(true, []string{"rate"}))
+	suite.Require().Error(validateRateExtrapolation(true, []string{"rate", "max"}))
+}
+
+func TestRateSuite(t *testing.T) {
+	suite.Run(t, new(rateSuite))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/v3io/v3io-tsdb/pkg/chunkenc"
+	"github.com/v3io/v3io-tsdb/pkg/utils"
+)
+
+type point struct {
+	t int64
+	v float64
+}
+
+// series is an in-memory copy of a queried series, for output modes that need all the data at hand
+type series struct {
+	labels utils.Labels
+	points []point
+}
+
+// readSeries drains a series set into memory. non-numeric series are skipped
+func readSeries(seriesSet utils.SeriesSet) ([]*series, error) {
+	var result []*series
+
+	for seriesSet.Next() {
+		currentSeries := &series{labels: seriesSet.At().Labels()}
+
+		iter := seriesSet.At().Iterator()
+		if iter.Encoding() != chunkenc.EncXOR {
+			continue
+		}
+
+		for iter.Next() {
+			t, v := iter.At()
+			currentSeries.points = append(currentSeries.points, point{t, v})
+		}
+
+		if iter.Err() != nil {
+			return nil, iter.Err()
+		}
+
+		result = append(result, currentSeries)
+	}
+
+	if seriesSet.Err() != nil {
+		return nil, seriesSet.Err()
+	}
+
+	return result, nil
+}
+
+// target returns the series identity in the form used by the json formatter (e.g. cpu{host=a,dc=7})
+func (s *series) target() string {
+	var name string
+	var labels []string
+
+	for _, label := range s.labels {
+		if label.Name == "__name__" {
+			name = label.Value
+		} else {
+			labels = append(labels, label.Name+"="+label.Value)
+		}
+	}
+
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// timestamps returns the sorted union of the timestamps of all series
+func timestamps(seriesList []*series) []int64 {
+	timestampSet := map[int64]struct{}{}
+
+	for _, currentSeries := range seriesList {
+		for _, currentPoint := range currentSeries.points {
+			timestampSet[currentPoint.t] = struct{}{}
+		}
+	}
+
+	result := make([]int64, 0, len(timestampSet))
+	for t := range timestampSet {
+		result = append(result, t)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+
+	return result
+}
+
+// seriesSet serves in-memory series through the SeriesSet interface, so that computed results can be
+// written like the TSDB's
+type seriesSet struct {
+	seriesList []*series
+	index      int
+}
+
+func newSeriesSet(seriesList []*series) *seriesSet {
+	return &seriesSet{seriesList: seriesList, index: -1}
+}
+
+func (ss *seriesSet) Next() bool {
+	ss.index++
+	return ss.index < len(ss.seriesList)
+}
+
+func (ss *seriesSet) At() utils.Series {
+	return ss.seriesList[ss.index]
+}
+
+func (ss *seriesSet) Err() error {
+	return nil
+}
+
+func (s *series) Labels() utils.Labels {
+	return s.labels
+}
+
+func (s *series) Iterator() utils.SeriesIterator {
+	samples := make([]utils.Sample, 0, len(s.points))
+	for _, currentPoint := range s.points {
+		samples = append(samples, utils.Sample{T: currentPoint.t, V: currentPoint.v})
+	}
+
+	return utils.NewSamplesIterator(samples)
+}
+
+func (s *series) GetKey() uint64 {
+	return s.labels.Hash()
+}